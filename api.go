@@ -1,11 +1,16 @@
 package neverdown
 
 import (
+	"crypto/sha1"
+	"fmt"
 	"net/http"
 	"net"
 	"log"
+	"io"
+	"io/ioutil"
 	"encoding/json"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -32,6 +37,9 @@ func RedirectToLeader(leader *bool, ra *Raft, handlerFunc http.HandlerFunc) http
 				hostname = string(bhostname)
 			}
 			redirectTo := "http://"+hostname+":"+strconv.Itoa(ra.Leader().(*net.TCPAddr).Port-10)+r.URL.Path
+			if r.URL.RawQuery != "" {
+				redirectTo += "?" + r.URL.RawQuery
+			}
 			log.Printf("Redirect request to leader: %v", redirectTo)
 			http.Redirect(w, r, redirectTo, http.StatusTemporaryRedirect)
 		}
@@ -48,9 +56,7 @@ func checksHandler(reload chan<- struct{}, ra *Raft) func(http.ResponseWriter, *
 			res := map[string][]*Check{
 				"checks": []*Check{},
 			}
-			for _, check := range ra.Store.ChecksIndex {
-				res["checks"] = append(res["checks"], check)
-			}
+			res["checks"] = append(res["checks"], ra.Store.Checks()...)
 			WriteJSON(w, res)
 		case "POST":
 			defer r.Body.Close()
@@ -61,14 +67,14 @@ func checksHandler(reload chan<- struct{}, ra *Raft) func(http.ResponseWriter, *
 			if check.ID == "" {
 				check.ID = uuid()
 			}
-			js, err := json.Marshal(check)
-			if err != nil {
-				panic(err)
+			if old := ra.Store.Check(check.ID); old != nil {
+				check.keepSecrets(old)
 			}
-			msg := make([]byte, len(js)+1)
-			msg[0] = 0
-			copy(msg[1:], js)
-			if err := ra.ExecCommand(msg); err != nil {
+			if err := check.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := ra.ExecCommand(check.ToPostCmd()); err != nil {
 				panic(err)
 			}
 			reload<- struct{}{}
@@ -89,9 +95,7 @@ func pendingHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
 			res := map[string][]*WebHook{
 				"pending": []*WebHook{},
 			}
-			for _, wh := range ra.Store.PendingWebHooksIndex {
-				res["pending"] = append(res["pending"], wh)
-			}
+			res["pending"] = append(res["pending"], ra.Store.PendingWebHooks()...)
 			WriteJSON(w, res)
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -107,8 +111,7 @@ func pendingByIDHandler(reload chan<- struct{}, ra *Raft) func(http.ResponseWrit
 			if err := ra.Sync(); err != nil {
 				panic(err)
 			}
-			wh, exists := ra.Store.PendingWebHooksIndex[vars["id"]]
-			if exists {
+			if wh := ra.Store.PendingWebHook(vars["id"]); wh != nil {
 				WriteJSON(w, wh)
 			} else {
 				http.Error(w, http.StatusText(404), 404)
@@ -137,8 +140,7 @@ func checkHandler(reload chan<- struct{}, ra *Raft) func(http.ResponseWriter, *h
 			if err := ra.Sync(); err != nil {
 				panic(err)
 			}
-			check, exists := ra.Store.ChecksIndex[vars["id"]]
-			if exists {
+			if check := ra.Store.Check(vars["id"]); check != nil {
 				WriteJSON(w, check)
 			} else {
 				http.Error(w, http.StatusText(404), 404)
@@ -158,6 +160,202 @@ func checkHandler(reload chan<- struct{}, ra *Raft) func(http.ResponseWriter, *h
 	}
 }
 
+func historyHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		switch r.Method {
+		case "GET":
+			if ra.Store.Check(vars["id"]) == nil {
+				http.Error(w, http.StatusText(404), 404)
+				return
+			}
+			var from, to int64
+			var err error
+			if v := r.FormValue("from"); v != "" {
+				if from, err = strconv.ParseInt(v, 10, 64); err != nil {
+					http.Error(w, "invalid from", http.StatusBadRequest)
+					return
+				}
+			}
+			if v := r.FormValue("to"); v != "" {
+				if to, err = strconv.ParseInt(v, 10, 64); err != nil {
+					http.Error(w, "invalid to", http.StatusBadRequest)
+					return
+				}
+			}
+			WriteJSON(w, map[string][]*Result{"history": ra.Store.History(vars["id"], from, to)})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func slaHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		switch r.Method {
+		case "GET":
+			check := ra.Store.Check(vars["id"])
+			if check == nil {
+				http.Error(w, http.StatusText(404), 404)
+				return
+			}
+			period := r.FormValue("period")
+			if period == "" {
+				period = "30d"
+			}
+			sla, err := ra.Store.SLA(check, period, time.Now().UTC())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			WriteJSON(w, sla)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func pendingRetryHandler(whSched *WebHookScheduler, ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		switch r.Method {
+		case "POST":
+			if err := ra.Sync(); err != nil {
+				panic(err)
+			}
+			wh := ra.Store.PendingWebHook(vars["id"])
+			if wh == nil {
+				http.Error(w, http.StatusText(404), 404)
+				return
+			}
+			if err := whSched.RetryNow(wh.ID); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			WriteJSON(w, wh)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func deadHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			if err := ra.Sync(); err != nil {
+				panic(err)
+			}
+			res := map[string][]*WebHook{
+				"dead": []*WebHook{},
+			}
+			res["dead"] = append(res["dead"], ra.Store.DeadWebHooks()...)
+			WriteJSON(w, res)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func deadByIDHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := ra.Sync(); err != nil {
+			panic(err)
+		}
+		wh := ra.Store.DeadWebHook(vars["id"])
+		if wh == nil {
+			http.Error(w, http.StatusText(404), 404)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			WriteJSON(w, wh)
+		case "DELETE":
+			if err := ra.ExecCommand(wh.ToDeleteDeadCmd()); err != nil {
+				panic(err)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func deadReplayHandler(whSched *WebHookScheduler, ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		switch r.Method {
+		case "POST":
+			if err := ra.Sync(); err != nil {
+				panic(err)
+			}
+			wh := ra.Store.DeadWebHook(vars["id"])
+			if wh == nil {
+				http.Error(w, http.StatusText(404), 404)
+				return
+			}
+			if err := ReplayWebHook(ra, wh); err != nil {
+				panic(err)
+			}
+			// The replayed webhook is pending, it will be retried at its scheduled time if the retry can't be forced
+			if err := whSched.RetryNow(wh.ID); err != nil {
+				log.Printf("Failed to force the retry of webhook %v: %v", wh.ID, err)
+			}
+			WriteJSON(w, ra.Store.PendingWebHook(wh.ID))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func deliveriesHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			q := r.URL.Query()
+			WriteJSON(w, map[string][]*Delivery{"deliveries": ra.Store.Deliveries(q.Get("check_id"), q.Get("webhook_id"))})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func incidentsHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		switch r.Method {
+		case "GET":
+			if checkID, ok := vars["id"]; ok {
+				if ra.Store.Check(checkID) == nil {
+					http.Error(w, http.StatusText(404), 404)
+					return
+				}
+			}
+			WriteJSON(w, map[string][]*Incident{"incidents": ra.Store.Incidents(vars["id"])})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func incidentHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		switch r.Method {
+		case "GET":
+			incident := ra.Store.Incident(vars["id"])
+			if incident == nil {
+				http.Error(w, http.StatusText(404), 404)
+				return
+			}
+			WriteJSON(w, incident)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
 func clusterHandler(reload chan<- struct{}, ra *Raft) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -175,13 +373,158 @@ func pingHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "GET":
-			method := r.FormValue("method")
-			if method == "" {
-				method = "HEAD"
+			check := NewCheck()
+			check.Type = r.FormValue("type")
+			check.URL = r.FormValue("url")
+			if method := r.FormValue("method"); method != "" {
+				check.Method = method
+			}
+			pr, err := PerformCheck(check)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
 			}
-			pr, _ := PerformCheck(method, r.FormValue("url"))
+			pr.Node = ResolveAPIAddr(ra.Addr)
 			log.Printf("local /_ping request: %+v", pr)
 			WriteJSON(w, pr)
+		case "POST":
+			// The leader sends the full check to perform the exact same request
+			defer r.Body.Close()
+			check := NewCheck()
+			if err := json.NewDecoder(r.Body).Decode(check); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := check.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			pr, err := PerformCheck(check)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			pr.Node = ResolveAPIAddr(ra.Addr)
+			log.Printf("local /_ping request: %+v", pr)
+			WriteJSON(w, pr)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func heartbeatHandler(ra *Raft, kind string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		switch r.Method {
+		case "GET", "POST":
+			check := ra.Store.Check(vars["id"])
+			if check == nil || check.CheckType() != "heartbeat" {
+				http.Error(w, http.StatusText(404), 404)
+				return
+			}
+			hb := NewHeartbeat(check.ID, kind)
+			if kind == HeartbeatFail && r.Body != nil {
+				defer r.Body.Close()
+				msg, _ := ioutil.ReadAll(io.LimitReader(r.Body, 1024))
+				hb.Message = string(msg)
+			}
+			if err := ra.ExecCommand(hb.ToCmd()); err != nil {
+				panic(err)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func metricsHandler(leader *bool, ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			mw := &metricsWriter{}
+			WriteMetrics(mw, *leader, ra)
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			w.Write(mw.buf.Bytes())
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// statusPageHandler serves the public status page, it is served by any node
+// (using its local copy of the FSM) to stay available during leader elections.
+func statusPageHandler(ra *Raft, asJSON bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			page := NewStatusPage(ra.Store, time.Now().UTC())
+			if asJSON {
+				WriteJSON(w, page)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := statusPageTpl.Execute(w, page); err != nil {
+				log.Printf("Failed to render the status page: %v", err)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// badgeHandler serves the SVG badge of a check, like the status page,
+// it is served by any node and only for the public checks.
+func badgeHandler(ra *Raft) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		switch r.Method {
+		case "GET":
+			check := ra.Store.Check(vars["id"])
+			if check == nil || !check.Public {
+				http.Error(w, http.StatusText(404), 404)
+				return
+			}
+			style := r.FormValue("style")
+			if style == "" {
+				style = "flat"
+			}
+			valid := false
+			for _, s := range BadgeStyles {
+				valid = valid || s == style
+			}
+			if !valid {
+				http.Error(w, "invalid style", http.StatusBadRequest)
+				return
+			}
+			badge := NewStatusBadge(check, style)
+			if r.FormValue("type") == "uptime" {
+				window := r.FormValue("window")
+				if window == "" {
+					window = "30d"
+				}
+				var err error
+				if badge, err = NewUptimeBadge(check, window, style); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if label := r.FormValue("label"); label != "" {
+				badge.Label = label
+			}
+			svg, err := badge.SVG()
+			if err != nil {
+				panic(err)
+			}
+			etag := fmt.Sprintf(`"%x"`, sha1.Sum(svg))
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write(svg)
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
@@ -192,10 +535,28 @@ func APIListenAndserve(leader *bool, ra *Raft, sched *Scheduler) error {
 	r := mux.NewRouter()
 	r.HandleFunc("/_cluster", clusterHandler(sched.Reloadch, ra))
 	r.HandleFunc("/_ping", pingHandler(ra))
+	r.HandleFunc("/metrics", metricsHandler(leader, ra))
+	r.HandleFunc("/status", statusPageHandler(ra, false))
+	r.HandleFunc("/status.json", statusPageHandler(ra, true))
+	r.HandleFunc("/badge/{id}.svg", badgeHandler(ra))
 	r.HandleFunc("/check", RedirectToLeader(leader, ra, checksHandler(sched.Reloadch, ra)))
 	r.HandleFunc("/check/{id}", RedirectToLeader(leader, ra, checkHandler(sched.Reloadch, ra)))
+	// The history, SLA, incidents and deliveries are replicated, every node serves them from its local FSM
+	r.HandleFunc("/check/{id}/history", historyHandler(ra))
+	r.HandleFunc("/check/{id}/sla", slaHandler(ra))
+	r.HandleFunc("/check/{id}/incidents", incidentsHandler(ra))
+	r.HandleFunc("/incidents", incidentsHandler(ra))
+	r.HandleFunc("/incidents/{id}", incidentHandler(ra))
+	r.HandleFunc("/heartbeat/{id}", RedirectToLeader(leader, ra, heartbeatHandler(ra, HeartbeatPing)))
+	r.HandleFunc("/heartbeat/{id}/start", RedirectToLeader(leader, ra, heartbeatHandler(ra, HeartbeatStart)))
+	r.HandleFunc("/heartbeat/{id}/fail", RedirectToLeader(leader, ra, heartbeatHandler(ra, HeartbeatFail)))
 	r.HandleFunc("/pending", RedirectToLeader(leader, ra, pendingHandler(ra)))
 	r.HandleFunc("/pending/{id}", RedirectToLeader(leader, ra, pendingByIDHandler(sched.Reloadch, ra)))
+	r.HandleFunc("/pending/{id}/retry", RedirectToLeader(leader, ra, pendingRetryHandler(sched.webhookSched, ra)))
+	r.HandleFunc("/dead", RedirectToLeader(leader, ra, deadHandler(ra)))
+	r.HandleFunc("/dead/{id}", RedirectToLeader(leader, ra, deadByIDHandler(ra)))
+	r.HandleFunc("/dead/{id}/replay", RedirectToLeader(leader, ra, deadReplayHandler(sched.webhookSched, ra)))
+	r.HandleFunc("/deliveries", deliveriesHandler(ra))
 	http.Handle("/", r)
 	return http.ListenAndServe(ResolveAPIAddr(ra.Addr), nil)
 }
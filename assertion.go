@@ -0,0 +1,75 @@
+package neverdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// maxBodySize is the maximum number of bytes of the response body read for assertions.
+var maxBodySize int64 = 1 << 20
+
+// Assertion is a check performed on the response body, only one of
+// Contains/NotContains/Regex should be set.
+type Assertion struct {
+	Contains    string `json:"contains,omitempty"`
+	NotContains string `json:"not_contains,omitempty"`
+	Regex       string `json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Validate ensures the assertion is well formed.
+func (a *Assertion) Validate() error {
+	set := 0
+	for _, v := range []string{a.Contains, a.NotContains, a.Regex} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("an assertion must have exactly one of contains/not_contains/regex")
+	}
+	if a.Regex != "" {
+		re, err := regexp.Compile(a.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %v", a.Regex, err)
+		}
+		a.re = re
+	}
+	return nil
+}
+
+// compile compiles the regex of a decoded assertion, an invalid regex is
+// reported by Check. The regex is compiled before the check is shared (the
+// scheduler copies share the assertions).
+func (a *Assertion) compile() {
+	if a.Regex == "" {
+		return
+	}
+	if re, err := regexp.Compile(a.Regex); err == nil {
+		a.re = re
+	}
+}
+
+// Check returns an error describing the failure if the body doesn't satisfy the assertion.
+func (a *Assertion) Check(body []byte) error {
+	switch {
+	case a.Contains != "":
+		if !bytes.Contains(body, []byte(a.Contains)) {
+			return fmt.Errorf("body does not contain %q", a.Contains)
+		}
+	case a.NotContains != "":
+		if bytes.Contains(body, []byte(a.NotContains)) {
+			return fmt.Errorf("body contains %q", a.NotContains)
+		}
+	case a.Regex != "":
+		if a.re == nil {
+			return fmt.Errorf("invalid regex %q", a.Regex)
+		}
+		if !a.re.Match(body) {
+			return fmt.Errorf("body does not match %q", a.Regex)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package neverdown
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// BadgeStyles lists the supported badge styles.
+var BadgeStyles = []string{"flat", "flat-square", "plastic"}
+
+// Badge colors
+const (
+	badgeGreen       = "#4c1"
+	badgeYellowGreen = "#a4a61d"
+	badgeYellow      = "#dfb317"
+	badgeRed         = "#e05d44"
+	badgeGrey        = "#9f9f9f"
+)
+
+// Badge is a shields-style SVG badge.
+type Badge struct {
+	Label   string
+	Message string
+	Color   string
+	Style   string
+}
+
+// textWidth approximates the width of the text rendered with Verdana 11px.
+func textWidth(s string) int {
+	return len(s)*7 + 10
+}
+
+func (b *Badge) LabelWidth() int   { return textWidth(b.Label) }
+func (b *Badge) MessageWidth() int { return textWidth(b.Message) }
+func (b *Badge) Width() int        { return b.LabelWidth() + b.MessageWidth() }
+
+// Radius returns the corner radius given the badge style.
+func (b *Badge) Radius() int {
+	switch b.Style {
+	case "flat-square":
+		return 0
+	case "plastic":
+		return 4
+	default:
+		return 3
+	}
+}
+
+// Height returns the badge height given the badge style.
+func (b *Badge) Height() int {
+	if b.Style == "plastic" {
+		return 18
+	}
+	return 20
+}
+
+// Gradient returns the opacity of the gradient overlay (0 for none).
+func (b *Badge) Gradient() string {
+	switch b.Style {
+	case "flat-square":
+		return "0"
+	case "plastic":
+		return ".3"
+	default:
+		return ".1"
+	}
+}
+
+var badgeFuncs = template.FuncMap{
+	"esc": template.HTMLEscapeString,
+	"half": func(i int) int {
+		return i / 2
+	},
+	"add": func(a, b int) int {
+		return a + b
+	},
+}
+
+var badgeTpl = template.Must(template.New("badge").Funcs(badgeFuncs).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" role="img" aria-label="{{esc .Label}}: {{esc .Message}}">
+<title>{{esc .Label}}: {{esc .Message}}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#fff" stop-opacity="{{.Gradient}}"/><stop offset="1" stop-opacity="{{.Gradient}}"/></linearGradient>
+<clipPath id="r"><rect width="{{.Width}}" height="{{.Height}}" rx="{{.Radius}}" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="{{.LabelWidth}}" height="{{.Height}}" fill="#555"/>
+<rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="{{.Height}}" fill="{{.Color}}"/>
+<rect width="{{.Width}}" height="{{.Height}}" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{half .LabelWidth}}" y="{{add (half .Height) 4}}">{{esc .Label}}</text>
+<text x="{{add .LabelWidth (half .MessageWidth)}}" y="{{add (half .Height) 4}}">{{esc .Message}}</text>
+</g>
+</svg>
+`))
+
+// SVG renders the badge.
+func (b *Badge) SVG() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := badgeTpl.Execute(&buf, b); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// uptimeColor returns the badge color for the given uptime percentage.
+func uptimeColor(uptime float64) string {
+	switch {
+	case uptime >= 99.9:
+		return badgeGreen
+	case uptime >= 99:
+		return badgeYellowGreen
+	case uptime >= 95:
+		return badgeYellow
+	default:
+		return badgeRed
+	}
+}
+
+// NewStatusBadge returns a badge displaying the check status.
+func NewStatusBadge(check *Check, style string) *Badge {
+	b := &Badge{Label: check.DisplayName(), Message: check.Status, Style: style}
+	switch check.Status {
+	case StatusUp:
+		b.Color = badgeGreen
+	case StatusDegraded:
+		b.Color = badgeYellow
+	case StatusDown:
+		b.Color = badgeRed
+	default:
+		b.Color = badgeGrey
+	}
+	return b
+}
+
+// NewUptimeBadge returns a badge displaying the check uptime over the given
+// window ("all" or one of the UptimeWindows).
+func NewUptimeBadge(check *Check, window, style string) (*Badge, error) {
+	uptime := float64(check.Uptime)
+	if window != "all" {
+		var ok bool
+		uptime, ok = check.Uptimes[window]
+		if !ok {
+			valid := false
+			for _, w := range UptimeWindows {
+				valid = valid || w == window
+			}
+			if !valid {
+				return nil, fmt.Errorf("invalid window %q", window)
+			}
+			// Not computed yet
+			uptime = 100.0
+		}
+	}
+	return &Badge{
+		Label:   "uptime " + window,
+		Message: fmt.Sprintf("%.2f%%", uptime),
+		Color:   uptimeColor(uptime),
+		Style:   style,
+	}, nil
+}
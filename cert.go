@@ -0,0 +1,114 @@
+package neverdown
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net"
+	nurl "net/url"
+	"strings"
+	"time"
+)
+
+// CertInfo holds the details of the peer certificate chain seen during a check.
+type CertInfo struct {
+	// NotAfter is the earliest expiration date (Unix timestamp) of the chain.
+	NotAfter int64    `json:"not_after"`
+	Issuer   string   `json:"issuer"`
+	Subject  string   `json:"subject"`
+	SANs     []string `json:"sans"`
+}
+
+// Expires returns the expiration date in a human readable format.
+func (ci *CertInfo) Expires() string {
+	return time.Unix(ci.NotAfter, 0).UTC().Format(time.RFC1123)
+}
+
+// NewCertInfo extracts the CertInfo from the peer certificate chain,
+// returns nil if there is no certificate.
+func NewCertInfo(certs []*x509.Certificate) *CertInfo {
+	if len(certs) == 0 {
+		return nil
+	}
+	leaf := certs[0]
+	ci := &CertInfo{
+		NotAfter: leaf.NotAfter.Unix(),
+		Issuer:   leaf.Issuer.String(),
+		Subject:  leaf.Subject.String(),
+		SANs:     []string{},
+	}
+	ci.SANs = append(ci.SANs, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		ci.SANs = append(ci.SANs, ip.String())
+	}
+	// An expired intermediate breaks the chain too
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Unix() < ci.NotAfter {
+			ci.NotAfter = cert.NotAfter.Unix()
+		}
+	}
+	return ci
+}
+
+// isTLSError returns true if the error is caused by an invalid certificate.
+func isTLSError(err error) bool {
+	var verr *tls.CertificateVerificationError
+	var cerr x509.CertificateInvalidError
+	var uerr x509.UnknownAuthorityError
+	var herr x509.HostnameError
+	return errors.As(err, &verr) || errors.As(err, &cerr) || errors.As(err, &uerr) || errors.As(err, &herr)
+}
+
+// TLSChecker checks that a TLS handshake succeeds (tls://host:port),
+// the peer certificate chain is recorded in the PingResponse.
+type TLSChecker struct{}
+
+// Check performs a TLS handshake with the check URL host and returns a PingResponse.
+func (tc *TLSChecker) Check(check *Check) (*PingResponse, error) {
+	log.Printf("Checking %v...", check.URL)
+	pr := &PingResponse{
+		URL: check.URL,
+	}
+	u, err := nurl.Parse(check.URL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "443")
+	}
+	dialer := &net.Dialer{Timeout: tcpTimeout}
+	start := time.Now()
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{})
+	pr.Timings = &Timings{Total: millis(time.Since(start))}
+	if err != nil {
+		errs := strings.Split(err.Error(), ": ")
+		pr.Error.Error = errs[len(errs)-1]
+		if isTLSError(err) {
+			pr.Error.Type = "tls"
+			return pr, nil
+		}
+		switch cerr := err.(type) {
+		case *net.OpError:
+			switch cerr.Err.(type) {
+			case *net.DNSError:
+				pr.Error.Type = "dns"
+			default:
+				if cerr.Timeout() {
+					pr.Error.Type = "timeout"
+				} else {
+					pr.Error.Type = "server"
+				}
+			}
+		default:
+			LogUnknownError("tls", err, nil)
+			pr.Error.Type = "unknown"
+		}
+		return pr, nil
+	}
+	defer conn.Close()
+	pr.Cert = NewCertInfo(conn.ConnectionState().PeerCertificates)
+	pr.Up = true
+	return pr, nil
+}
@@ -1,13 +1,14 @@
 package neverdown
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"net"
 	"net/http"
-	nurl "net/url"
+	"net/http/httptrace"
 	"strings"
 	"time"
 )
@@ -16,15 +17,97 @@ var client = &http.Client{
 	Timeout: 10 * time.Second,
 }
 
+// checkTransport is used by HTTP checks, keep-alives are disabled so every
+// check opens a new connection.
+var checkTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	DisableKeepAlives:   true,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// newCheckClient builds the HTTP client for the given check, honoring its
+// redirect policy, followed redirects are recorded in the PingResponse.
+func newCheckClient(check *Check, pr *PingResponse) *http.Client {
+	return &http.Client{
+		Timeout:   client.Timeout,
+		Transport: checkTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !check.FollowRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > check.MaxRedirects {
+				// Keep the last redirect response, the status is checked by the HTTPChecker
+				return http.ErrUseLastResponse
+			}
+			pr.Redirects = append(pr.Redirects, req.URL.String())
+			return nil
+		},
+	}
+}
+
 // PingResponse is the results of a check PING
 type PingResponse struct {
-	URL   string `json:"url"`
-	Up    bool   `json:"up"`
-	Error struct {
-		StatusCode int    `json:"status_code"`
-		Type       string `json:"type"`
-		Error      string `json:"error"`
-	} `json:"error"`
+	URL  string    `json:"url"`
+	Up   bool      `json:"up"`
+	Cert *CertInfo `json:"cert,omitempty"`
+	// Degraded is true if the response time exceeds the check WarnLatency.
+	Degraded bool `json:"degraded"`
+	// FinalURL is the URL of the last request if redirects were followed.
+	FinalURL  string   `json:"final_url,omitempty"`
+	Redirects []string `json:"redirects,omitempty"`
+	Timings   *Timings `json:"timings,omitempty"`
+	// Answers of DNS checks
+	Answers []string `json:"answers,omitempty"`
+	// Node is the API address of the node that performed the check
+	Node  string    `json:"node,omitempty"`
+	Error PingError `json:"error"`
+}
+
+// PingError describes why a check failed.
+type PingError struct {
+	StatusCode int    `json:"status_code"`
+	Type       string `json:"type"`
+	Error      string `json:"error"`
+}
+
+// Truncated returns a copy of the error with the message limited to MaxDeliveryResponse bytes.
+func (perr PingError) Truncated() PingError {
+	if len(perr.Error) > MaxDeliveryResponse {
+		perr.Error = perr.Error[:MaxDeliveryResponse]
+	}
+	return perr
+}
+
+// Checker is implemented by every check type (HTTP, TCP...).
+type Checker interface {
+	// Check performs the check and returns a PingResponse, an error is only
+	// returned if the check can't be performed at all.
+	Check(check *Check) (*PingResponse, error)
+}
+
+// Checkers is the registry of available check types.
+var Checkers = map[string]Checker{
+	"http":      &HTTPChecker{},
+	"tcp":       &TCPChecker{},
+	"tls":       &TLSChecker{},
+	"dns":       &DNSChecker{},
+	"heartbeat": &HeartbeatChecker{},
+}
+
+// CheckType returns the type of the check, if no type is specified,
+// it is guessed from the URL scheme (even if the URL is invalid, so it's
+// reported by Validate instead of falling back to an HTTP check).
+func (c *Check) CheckType() string {
+	if c.Type != "" {
+		return c.Type
+	}
+	if i := strings.Index(c.URL, "://"); i > 0 {
+		scheme := strings.ToLower(c.URL[:i])
+		if _, ok := Checkers[scheme]; ok {
+			return scheme
+		}
+	}
+	return "http"
 }
 
 func LogUnknownError(lvl string, err, baseErr error) {
@@ -32,59 +115,133 @@ func LogUnknownError(lvl string, err, baseErr error) {
 Please open an issue in the GitHub repository at https://github.com/tsileo/neverdown.`, lvl, err, baseErr)
 }
 
-// PerformCheck execute the check request and returns a PingResponse.
-func PerformCheck(method, url string) (*PingResponse, error) {
+// PerformCheck dispatches the check to the Checker registered for its type
+// and returns a PingResponse.
+func PerformCheck(check *Check) (*PingResponse, error) {
+	checker, ok := Checkers[check.CheckType()]
+	if !ok {
+		return nil, fmt.Errorf("unknown check type %q", check.CheckType())
+	}
+	pr, err := checker.Check(check)
+	if err != nil {
+		return nil, err
+	}
+	checkLatency(check, pr)
+	return pr, nil
+}
+
+// checkLatency flags the PingResponse as down if the response time exceeds
+// MaxLatency, or degraded if it exceeds WarnLatency.
+func checkLatency(check *Check, pr *PingResponse) {
+	if !pr.Up || pr.Timings == nil {
+		return
+	}
+	if check.MaxLatency > 0 && pr.Timings.Total > float64(check.MaxLatency) {
+		pr.Up = false
+		pr.Error.Type = "latency"
+		pr.Error.Error = fmt.Sprintf("response time %.0fms exceeds %vms", pr.Timings.Total, check.MaxLatency)
+		return
+	}
+	if check.WarnLatency > 0 && pr.Timings.Total > float64(check.WarnLatency) {
+		pr.Degraded = true
+	}
+}
+
+// newCheckRequest builds the HTTP request (headers, body and auth) for the given check.
+func newCheckRequest(check *Check) (*http.Request, error) {
+	var body io.Reader
+	if check.Body != "" {
+		body = strings.NewReader(check.Body)
+	}
+	request, err := http.NewRequest(check.Method, check.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range check.Headers {
+		if http.CanonicalHeaderKey(key) == "Host" {
+			request.Host = value
+			continue
+		}
+		request.Header.Set(key, value)
+	}
+	if check.Auth != nil {
+		switch check.Auth.Type {
+		case "basic":
+			request.SetBasicAuth(check.Auth.Username, check.Auth.Password)
+		case "bearer":
+			request.Header.Set("Authorization", "Bearer "+check.Auth.Token)
+		}
+	}
+	return request, nil
+}
+
+// HTTPChecker checks that an HTTP URL returns a 200 status code.
+type HTTPChecker struct{}
+
+// Check execute the check request and returns a PingResponse.
+func (hc *HTTPChecker) Check(check *Check) (*PingResponse, error) {
 	// TODO better check url//better response
+	url := check.URL
 	log.Printf("Checking %v...", url)
 	pr := &PingResponse{
 		URL: url,
 	}
-	request, err := http.NewRequest(method, url, nil)
+	request, err := newCheckRequest(check)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := client.Do(request)
+	trace := newCheckTrace()
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace.ClientTrace()))
+	resp, err := newCheckClient(check, pr).Do(request)
 	if err != nil {
-		nerr, ok := err.(*nurl.Error)
-		if ok {
-			switch cerr := nerr.Err.(type) {
-			case *net.OpError:
-				switch cerr.Err.(type) {
-				case *net.DNSError:
-					pr.Error.Type = "dns"
-					errs := strings.Split(cerr.Error(), ": ")
-					pr.Error.Error = errs[len(errs)-1]
-				default:
-					LogUnknownError("2", cerr, nerr)
-					errs := strings.Split(cerr.Error(), ": ")
-					pr.Error.Error = errs[len(errs)-1]
-					pr.Error.Type = "server"
-				}
-			default:
-				switch nerr.Err.Error() {
-				case "net/http: request canceled while waiting for connection":
-					pr.Error.Type = "timeout"
-					pr.Error.Error = "timeout exceeded"
-				default:
-					LogUnknownError("1", cerr, nerr)
-					pr.Error.Type = "unknown"
-					errs := strings.Split(cerr.Error(), ": ")
-					pr.Error.Error = errs[len(errs)-1]
-				}
-			}
-		} else {
-			LogUnknownError("0", err, nil)
-			pr.Error.Type = "unknown"
-			pr.Error.Error = err.Error()
+		pr.Timings = trace.Done()
+		pr.Error.Type = trace.ErrorType(err)
+		switch pr.Error.Type {
+		case "timeout":
+			pr.Error.Error = "timeout exceeded"
+		case "unknown":
+			LogUnknownError("http", err, nil)
+			fallthrough
+		default:
+			errs := strings.Split(err.Error(), ": ")
+			pr.Error.Error = errs[len(errs)-1]
 		}
 		return pr, nil
 	}
+	defer func() {
+		pr.Timings = trace.Done()
+	}()
 	defer resp.Body.Close()
+	if len(pr.Redirects) > 0 {
+		pr.FinalURL = resp.Request.URL.String()
+	}
+	if resp.TLS != nil {
+		pr.Cert = NewCertInfo(resp.TLS.PeerCertificates)
+	}
 	pr.Error.StatusCode = resp.StatusCode
-	if resp.StatusCode == 200 {
+	if MatchStatus(check.ExpectedStatus, resp.StatusCode) {
+		if len(check.Assertions) > 0 {
+			body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+			if err != nil {
+				pr.Error.Type = "response"
+				pr.Error.Error = err.Error()
+				return pr, nil
+			}
+			for _, assertion := range check.Assertions {
+				if err := assertion.Check(body); err != nil {
+					pr.Error.Type = "assertion"
+					pr.Error.Error = err.Error()
+					return pr, nil
+				}
+			}
+		}
 		pr.Up = true
+	} else if tooManyRedirects(check, pr, resp) {
+		pr.Error.Type = "redirect"
+		pr.Error.Error = fmt.Sprintf("stopped after %d redirects", check.MaxRedirects)
 	} else {
-		body, err := ioutil.ReadAll(resp.Body)
+		// Only the beginning of the body is kept, the error is stored in the history
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(MaxDeliveryResponse)))
 		if err != nil {
 			return pr, nil
 		}
@@ -94,14 +251,29 @@ func PerformCheck(method, url string) (*PingResponse, error) {
 	return pr, nil
 }
 
+// tooManyRedirects returns true if the response is a redirect that wasn't
+// followed because the check MaxRedirects was reached.
+func tooManyRedirects(check *Check, pr *PingResponse, resp *http.Response) bool {
+	if !check.FollowRedirects || len(pr.Redirects) < check.MaxRedirects {
+		return false
+	}
+	return resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != ""
+}
+
 // PerformAPICheck query the ping api of the given remote peer for the given URL.
-func PerformAPICheck(peer, method, url string) (*PingResponse, error) {
-	log.Printf("Calling remote peer %v for confirmation on %v...", peer, url)
+func PerformAPICheck(peer string, check *Check) (*PingResponse, error) {
+	log.Printf("Calling remote peer %v for confirmation on %v...", peer, check.URL)
 	pingResponse := &PingResponse{}
-	request, err := http.NewRequest("GET", "http://"+peer+"/_ping?method="+method+"&url="+url, nil)
+	// The peers need the check secrets to perform the check
+	js, err := json.Marshal((*fsmCheck)(check))
 	if err != nil {
 		return nil, err
 	}
+	request, err := http.NewRequest("POST", "http://"+peer+"/_ping", bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
 	resp, err := client.Do(request)
 	if err != nil {
 		return nil, err
@@ -116,48 +288,94 @@ func PerformAPICheck(peer, method, url string) (*PingResponse, error) {
 	return pingResponse, nil
 }
 
-// LeaderCheck is the check function called by the raft leader,
+// LeaderCheck is the check function called by the raft leader, it returns the leader
+// ping response followed by the followers responses (if any),
 // if the website is down for the leader , it will ask followers for confirmation,
 // if the website is down for one of the follower, a warning is emitted but the website isn't
 // declared down.
-func LeaderCheck(ra *Raft, check *Check) error {
-	log.Printf("Checking %v (up:%v/prev:%v)", check.URL, check.Up, check.Prev)
-	pr, err := PerformCheck(check.Method, check.URL)
+// The check is only declared down after FailureThreshold consecutive confirmed failures,
+// and up again after RecoveryThreshold consecutive successes.
+func LeaderCheck(ra *Raft, check *Check) ([]*PingResponse, error) {
+	log.Printf("Checking %v (status:%v/prev:%v)", check.URL, check.Status, check.Prev)
+	pr, err := PerformCheck(check)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	pr.Node = ResolveAPIAddr(ra.Addr)
+	prs := []*PingResponse{pr}
 	now := time.Now().UTC().Unix()
 	log.Printf("Check result: %+v", pr)
 	if check.FirstCheck == 0 {
 		check.FirstCheck = check.Next.Unix()
 	}
 	check.Pings++
+	if pr.Cert != nil {
+		check.Cert = pr.Cert
+	}
+	if pr.Timings != nil {
+		check.Timings = pr.Timings
+	}
 	if pr.Up {
-		check.Up = true
-		return nil
+		check.recordSuccess(pr)
+		return prs, nil
 	}
 	// If all the responses are down, too, the website is definitely down
 	// and we execute webhooks
-	prs := []*PingResponse{pr}
 	for _, peer := range ra.PeersAPI() {
-		ppr, err := PerformAPICheck(peer, check.Method, check.URL)
+		ppr, err := PerformAPICheck(peer, check)
 		if err != nil {
 			log.Printf("WARNING: failed to ask confirmation from remote peer %v: %v", peer, err)
 			continue
 		}
 		if ppr.Up {
 			log.Printf("WARNING: leader flagged the check as \"down\", but others peers found it \"up\": %+v", pr)
-			return nil
+			check.recordPeerUp()
+			return prs, nil
 		}
 		prs = append(prs, ppr)
 	}
-	if check.Up == true {
-		check.Outages++
+	check.recordFailure(pr, now)
+	return prs, nil
+}
+
+// recordSuccess updates the check status after a successful ping, the check
+// is only up again after RecoveryThreshold consecutive successes.
+func (c *Check) recordSuccess(pr *PingResponse) {
+	c.ConsecutiveFailures = 0
+	c.ConsecutiveSuccesses++
+	if c.Status == StatusDown && c.ConsecutiveSuccesses < c.RecoveryThreshold {
+		log.Printf("Check %v is up, %v/%v successes before recovery", c.ID, c.ConsecutiveSuccesses, c.RecoveryThreshold)
+		c.TimeDown += int64(c.Interval)
+		return
+	}
+	c.Up = true
+	c.Status = StatusUp
+	if pr.Degraded {
+		c.Status = StatusDegraded
+	}
+}
+
+// recordPeerUp is called when the leader ping failed but a peer found the
+// check up, the failures are no longer consecutive.
+func (c *Check) recordPeerUp() {
+	c.ConsecutiveFailures = 0
+}
+
+// recordFailure updates the check status after a confirmed failure, the check
+// is only down after FailureThreshold consecutive failures.
+func (c *Check) recordFailure(pr *PingResponse, now int64) {
+	c.ConsecutiveSuccesses = 0
+	c.ConsecutiveFailures++
+	c.LastError = pr.Error.Truncated()
+	if c.Status != StatusDown && c.ConsecutiveFailures < c.FailureThreshold {
+		log.Printf("Check %v is down, %v/%v failures before outage", c.ID, c.ConsecutiveFailures, c.FailureThreshold)
+		return
+	}
+	if c.Up == true {
+		c.Outages++
 	}
-	check.TimeDown += int64(check.Interval)
-	check.Up = false
-	check.LastDown = now
-	check.LastError = pr.Error
-	// POST request with list of ping reponse
-	return nil
+	c.TimeDown += int64(c.Interval)
+	c.Up = false
+	c.Status = StatusDown
+	c.LastDown = now
 }
@@ -0,0 +1,174 @@
+package neverdown
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPCheckTooManyRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+	}))
+	defer ts.Close()
+	check := NewCheck()
+	check.URL = ts.URL + "/"
+	check.Method = "GET"
+	check.MaxRedirects = 3
+	pr, err := PerformCheck(check)
+	if err != nil {
+		t.Fatalf("PerformCheck failed: %v", err)
+	}
+	if pr.Up {
+		t.Fatalf("check should be down")
+	}
+	if pr.Error.Type != "redirect" || pr.Error.StatusCode != http.StatusFound {
+		t.Errorf("unexpected error %+v", pr.Error)
+	}
+	if len(pr.Redirects) != 3 || pr.FinalURL != ts.URL+"/xxx" {
+		t.Errorf("unexpected redirects %v (final url %v)", pr.Redirects, pr.FinalURL)
+	}
+
+	// The last redirect response can be expected
+	check.ExpectedStatus = []string{"3xx"}
+	pr, err = PerformCheck(check)
+	if err != nil {
+		t.Fatalf("PerformCheck failed: %v", err)
+	}
+	if !pr.Up {
+		t.Errorf("check should be up, got %+v", pr.Error)
+	}
+}
+
+func TestHTTPCheckErrorBodyTruncated(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(strings.Repeat("x", 64*1024)))
+	}))
+	defer ts.Close()
+	check := NewCheck()
+	check.URL = ts.URL
+	check.Method = "GET"
+	pr, err := PerformCheck(check)
+	if err != nil {
+		t.Fatalf("PerformCheck failed: %v", err)
+	}
+	if pr.Up || pr.Error.Type != "response" {
+		t.Fatalf("unexpected response %+v", pr.Error)
+	}
+	if len(pr.Error.Error) != MaxDeliveryResponse {
+		t.Errorf("expected the body to be truncated to %d bytes, got %d", MaxDeliveryResponse, len(pr.Error.Error))
+	}
+
+	// Errors from remote peers are truncated again in the history
+	pr.Error.Error = strings.Repeat("y", 4096)
+	if res := NewResult(check, pr, 1000); len(res.Error.Error) != MaxDeliveryResponse {
+		t.Errorf("expected the result error to be truncated, got %d bytes", len(res.Error.Error))
+	}
+}
+
+func TestDecodeCheckCompilesAssertions(t *testing.T) {
+	check, err := decodeCheck([]byte(`{"id": "re", "assertions": [{"regex": "\"status\":\\s*\"ok\""}, {"contains": "ok"}]}`))
+	if err != nil {
+		t.Fatalf("failed to decode the check: %v", err)
+	}
+	if check.Assertions[0].re == nil {
+		t.Fatalf("regex should be compiled when the check is decoded")
+	}
+	if err := check.Assertions[0].Check([]byte(`{"status": "ok"}`)); err != nil {
+		t.Errorf("assertion failed: %v", err)
+	}
+	// A regex that wasn't compiled is an error
+	if err := (&Assertion{Regex: "ok"}).Check([]byte("ok")); err == nil {
+		t.Errorf("an uncompiled regex should be an error")
+	}
+}
+
+func TestHTTPCheckLatency(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+	for _, tc := range []struct {
+		warn, max int
+		up        bool
+		degraded  bool
+	}{
+		{0, 0, true, false},
+		{5000, 10000, true, false},
+		{100, 0, true, true},
+		{100, 10000, true, true},
+		{0, 100, false, false},
+		{50, 100, false, false},
+	} {
+		check := NewCheck()
+		check.URL = ts.URL
+		check.Method = "GET"
+		check.WarnLatency = tc.warn
+		check.MaxLatency = tc.max
+		if err := check.Validate(); err != nil {
+			t.Fatalf("invalid check: %v", err)
+		}
+		pr, err := PerformCheck(check)
+		if err != nil {
+			t.Fatalf("PerformCheck failed: %v", err)
+		}
+		if pr.Up != tc.up || pr.Degraded != tc.degraded {
+			t.Errorf("warn=%v max=%v: got up=%v degraded=%v (%+v)", tc.warn, tc.max, pr.Up, pr.Degraded, pr.Error)
+		}
+		if !tc.up && pr.Error.Type != "latency" {
+			t.Errorf("warn=%v max=%v: expected a latency error, got %+v", tc.warn, tc.max, pr.Error)
+		}
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	up := &PingResponse{Up: true}
+	degraded := &PingResponse{Up: true, Degraded: true}
+	down := &PingResponse{Error: PingError{Type: "server", Error: "connection refused"}}
+	check := NewCheck()
+	check.FailureThreshold = 3
+	check.RecoveryThreshold = 2
+	for i, step := range []struct {
+		// pr is nil when a peer found the check up
+		pr     *PingResponse
+		status string
+	}{
+		{down, StatusUp},
+		{down, StatusUp},
+		// A peer found the check up, the failures are reset
+		{nil, StatusUp},
+		{down, StatusUp},
+		{down, StatusUp},
+		// A success resets the failures too
+		{up, StatusUp},
+		{down, StatusUp},
+		{down, StatusUp},
+		{down, StatusDown},
+		{up, StatusDown},
+		{down, StatusDown},
+		{up, StatusDown},
+		{degraded, StatusDegraded},
+		{up, StatusUp},
+	} {
+		switch {
+		case step.pr == nil:
+			check.recordPeerUp()
+		case step.pr.Up:
+			check.recordSuccess(step.pr)
+		default:
+			check.recordFailure(step.pr, int64(i))
+		}
+		if check.Status != step.status {
+			t.Fatalf("step %d: got status %v, expected %v (failures=%d successes=%d)", i, check.Status, step.status, check.ConsecutiveFailures, check.ConsecutiveSuccesses)
+		}
+		if check.Up != (step.status != StatusDown) {
+			t.Errorf("step %d: up=%v doesn't match the status %v", i, check.Up, check.Status)
+		}
+	}
+	if check.Outages != 1 || check.LastDown != 10 || check.TimeDown != 4*int64(check.Interval) {
+		t.Errorf("unexpected outages=%d last_down=%d time_down=%d", check.Outages, check.LastDown, check.TimeDown)
+	}
+}
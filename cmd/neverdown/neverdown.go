@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,9 +16,66 @@ var (
 	RaftWarmUpTime        = 5 * time.Second
 )
 
+// envInt returns the integer value of the environment variable (nil if not set).
+func envInt(name string) *int {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid %v: %v", name, err)
+	}
+	return &i
+}
+
 func main() {
 	log.Printf("Starting neverdown version %v+%v; %v (%v/%v)", neverdown.Version, githash, runtime.Version(), runtime.GOOS, runtime.GOARCH)
 	leader := new(bool)
+	if title := os.Getenv("NEVERDOWN_STATUS_TITLE"); title != "" {
+		neverdown.StatusPageTitle = title
+	}
+	neverdown.WebHookSecret = os.Getenv("NEVERDOWN_WEBHOOK_SECRET")
+	retry := &neverdown.RetryPolicy{
+		MaxAttempts: envInt("NEVERDOWN_RETRY_MAX_ATTEMPTS"),
+		BaseDelay:   envInt("NEVERDOWN_RETRY_BASE_DELAY"),
+		MaxDelay:    envInt("NEVERDOWN_RETRY_MAX_DELAY"),
+		MaxAge:      envInt("NEVERDOWN_RETRY_MAX_AGE"),
+	}
+	if jitter := os.Getenv("NEVERDOWN_RETRY_JITTER"); jitter != "" {
+		f, err := strconv.ParseFloat(jitter, 64)
+		if err != nil {
+			log.Fatalf("invalid NEVERDOWN_RETRY_JITTER: %v", err)
+		}
+		retry.Jitter = &f
+	}
+	if err := retry.Validate(); err != nil {
+		log.Fatalf("invalid retry policy: %v", err)
+	}
+	neverdown.DefaultRetryPolicy = retry.WithDefaults()
+	neverdown.DeadLetterWebHook = os.Getenv("NEVERDOWN_DEAD_LETTER_WEBHOOK")
+	if emails := os.Getenv("NEVERDOWN_DEAD_LETTER_EMAILS"); emails != "" {
+		neverdown.DeadLetterEmails = strings.Split(emails, ",")
+	}
+	switch os.Getenv("NEVERDOWN_MAIL_BACKEND") {
+	case "smtp":
+		neverdown.DefaultMailer = &neverdown.SMTPMailer{
+			Addr:     os.Getenv("NEVERDOWN_SMTP_ADDR"),
+			Username: os.Getenv("NEVERDOWN_SMTP_USERNAME"),
+			Password: os.Getenv("NEVERDOWN_SMTP_PASSWORD"),
+			From:     os.Getenv("NEVERDOWN_MAIL_FROM"),
+			ReplyTo:  os.Getenv("NEVERDOWN_MAIL_REPLY_TO"),
+			StartTLS: os.Getenv("NEVERDOWN_SMTP_STARTTLS") == "1",
+		}
+	case "ses", "":
+		if from := os.Getenv("NEVERDOWN_MAIL_FROM"); from != "" {
+			neverdown.DefaultMailer = &neverdown.SESMailer{From: from}
+		} else {
+			log.Printf("NEVERDOWN_MAIL_FROM is not set, email notifications are disabled")
+		}
+	default:
+		log.Fatalf("unsupported mail backend %q", os.Getenv("NEVERDOWN_MAIL_BACKEND"))
+	}
 	log.Printf("Listening on %v", os.Getenv("NEVERDOWN_ADDR"))
 	r, err := neverdown.NewRaft(os.Getenv("NEVERDOWN_PREFIX"), os.Getenv("NEVERDOWN_ADDR"), strings.Split(os.Getenv("NEVERDOWN_PEERS"), ","))
 	if err != nil {
@@ -0,0 +1,95 @@
+package neverdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DeadLetterWebHook is the URL notified (with the JSON-encoded WebHook, without
+// its secret) when a WebHook is moved to the dead-letter queue.
+var DeadLetterWebHook = ""
+
+// DeadLetterEmails are notified when a WebHook is moved to the dead-letter queue.
+var DeadLetterEmails = []string{}
+
+// ToDeadCmd serializes a WebHook into a raft command moving it from the
+// pending webhooks to the dead-letter queue.
+func (wh *WebHook) ToDeadCmd() []byte {
+	js, err := json.Marshal((*fsmWebHook)(wh))
+	if err != nil {
+		panic(err)
+	}
+	msg := make([]byte, len(js)+1)
+	msg[0] = 8
+	copy(msg[1:], js)
+	return msg
+}
+
+// ToDeleteDeadCmd serializes a WebHook into a raft command removing it from
+// the dead-letter queue.
+func (wh *WebHook) ToDeleteDeadCmd() []byte {
+	buuid := []byte(wh.ID)
+	msg := make([]byte, len(buuid)+1)
+	msg[0] = 9
+	copy(msg[1:], buuid)
+	return msg
+}
+
+// DeadLetter moves an exhausted WebHook to the dead-letter queue, and sends the
+// dead-letter alert.
+func DeadLetter(ra *Raft, wh *WebHook) error {
+	wh.DeadAt = time.Now().UTC().Unix()
+	if err := ra.ExecCommand(wh.ToDeadCmd()); err != nil {
+		return err
+	}
+	go NotifyDeadLetter(wh)
+	return nil
+}
+
+// ReplayWebHook moves a WebHook from the dead-letter queue back to the pending
+// webhooks, with a new retry budget.
+func ReplayWebHook(ra *Raft, wh *WebHook) error {
+	replay := *wh
+	replay.Tries = 0
+	replay.FirstTry = time.Now().UTC().Unix()
+	replay.DeadAt = 0
+	if err := ra.ExecCommand(replay.ToPostCmd()); err != nil {
+		return err
+	}
+	return ra.ExecCommand(wh.ToDeleteDeadCmd())
+}
+
+// NotifyDeadLetter alerts the DeadLetterWebHook and DeadLetterEmails, the alert
+// is not retried (to avoid dead-letter loops).
+func NotifyDeadLetter(wh *WebHook) {
+	log.Printf("WebHook %v (%v) moved to the dead-letter queue after %v tries", wh.ID, wh.URL, wh.Tries)
+	if DeadLetterWebHook != "" {
+		payload, err := json.Marshal(wh)
+		if err != nil {
+			panic(err)
+		}
+		if _, _, err := SendWebHook(&WebHook{URL: DeadLetterWebHook, Payload: payload}); err != nil {
+			log.Printf("Failed to send the dead-letter alert for webhook %v: %v", wh.ID, err)
+		}
+	}
+	if len(DeadLetterEmails) == 0 || DefaultMailer == nil {
+		return
+	}
+	kind := wh.Kind
+	if kind == "" {
+		kind = "webhook"
+	}
+	subject := fmt.Sprintf("%v notification for check %v failed", kind, wh.CheckID)
+	body := fmt.Sprintf("The %v notification %v to %v was moved to the dead-letter queue after %v failed tries.\n", kind, wh.ID, wh.URL, wh.Tries)
+	if n := len(wh.Deliveries); n > 0 {
+		last := wh.Deliveries[n-1]
+		body += fmt.Sprintf("Last error: %v\n", last.Error)
+	}
+	for _, email := range DeadLetterEmails {
+		if err := DefaultMailer.SendMail(email, subject, body); err != nil {
+			log.Printf("Failed to send the dead-letter alert for webhook %v to %v: %v", wh.ID, email, err)
+		}
+	}
+}
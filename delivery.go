@@ -0,0 +1,61 @@
+package neverdown
+
+import (
+	"encoding/json"
+)
+
+// MaxDeliveries is the number of deliveries kept in the delivery log.
+var MaxDeliveries = 1000
+
+// MaxDeliveryResponse is the maximum size of the response body kept in a Delivery.
+var MaxDeliveryResponse = 512
+
+// Delivery is a notification delivery attempt.
+type Delivery struct {
+	WebHookID  string  `json:"webhook_id"`
+	CheckID    string  `json:"check_id,omitempty"`
+	Kind       string  `json:"kind"`
+	URL        string  `json:"url"`
+	Attempt    int     `json:"attempt"`
+	Time       int64   `json:"time"`
+	Success    bool    `json:"success"`
+	StatusCode int     `json:"status_code,omitempty"`
+	Latency    float64 `json:"latency_ms"`
+	Response   string  `json:"response,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// ToCmd serializes a Delivery into a raft command.
+func (d *Delivery) ToCmd() []byte {
+	js, err := json.Marshal(d)
+	if err != nil {
+		panic(err)
+	}
+	msg := make([]byte, len(js)+1)
+	msg[0] = 7
+	copy(msg[1:], js)
+	return msg
+}
+
+// AddDelivery appends a delivery to the delivery log, only the last MaxDeliveries deliveries are kept.
+func (s *Store) AddDelivery(d *Delivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.DeliveriesLog = append(s.DeliveriesLog, d)
+	if len(s.DeliveriesLog) > MaxDeliveries {
+		s.DeliveriesLog = append([]*Delivery{}, s.DeliveriesLog[len(s.DeliveriesLog)-MaxDeliveries:]...)
+	}
+}
+
+// Deliveries returns the deliveries matching the given check and webhook IDs (empty to ignore).
+func (s *Store) Deliveries(checkID, webhookID string) []*Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := []*Delivery{}
+	for _, d := range s.DeliveriesLog {
+		if (checkID == "" || d.CheckID == checkID) && (webhookID == "" || d.WebHookID == webhookID) {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries
+}
@@ -0,0 +1,292 @@
+package neverdown
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	nurl "net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var dnsTimeout = 10 * time.Second
+
+// DNSRecordTypes lists the supported record types of DNS checks.
+var DNSRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "TXT"}
+
+// DNSChecker queries a DNS record (dns://resolver:port/name, or dns:///name to use
+// the system resolver) and checks that the answers match the expected answers.
+type DNSChecker struct{}
+
+// newResolver returns a resolver querying the given server (host:port),
+// or the system resolver if no server is specified. The A and AAAA records are
+// queried with lookupAddrs when a server is specified, the resolver would
+// answer from /etc/hosts.
+func newResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// errMalformedDNS is returned when the DNS server response can't be parsed.
+var errMalformedDNS = errors.New("malformed DNS response")
+
+// dnsQuery returns a DNS query (with a random ID) for the given name and type.
+func dnsQuery(name string, qtype uint16) (uint16, []byte, error) {
+	id := uint16(rand.Intn(1 << 16))
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg, id)
+	// Recursion desired, one question
+	binary.BigEndian.PutUint16(msg[2:], 0x0100)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return 0, nil, fmt.Errorf("invalid name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, 1)
+	return id, msg, nil
+}
+
+// dnsExchange sends the query to the server (over UDP or TCP) and returns the response.
+func dnsExchange(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if network == "tcp" {
+		// TCP messages are prefixed with their length
+		if _, err := conn.Write(append([]byte{byte(len(query) >> 8), byte(len(query))}, query...)); err != nil {
+			return nil, err
+		}
+		size := make([]byte, 2)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(size))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, 512)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp[:n], nil
+}
+
+// skipDNSName returns the offset following the (possibly compressed) name at off.
+func skipDNSName(msg []byte, off int) (int, error) {
+	for off < len(msg) {
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xC0 == 0xC0:
+			if off+2 > len(msg) {
+				return 0, errMalformedDNS
+			}
+			return off + 2, nil
+		default:
+			off += 1 + l
+		}
+	}
+	return 0, errMalformedDNS
+}
+
+// lookupAddrs queries the A or AAAA records of the name directly on the server
+// (the net.Resolver answers from /etc/hosts before querying the server), the
+// CNAMEs followed by the server are skipped.
+func lookupAddrs(ctx context.Context, server, name, recordType string) ([]string, error) {
+	qtype := uint16(1)
+	if recordType == "AAAA" {
+		qtype = 28
+	}
+	id, query, err := dnsQuery(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := dnsExchange(ctx, "udp", server, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) >= 4 && resp[2]&0x02 != 0 {
+		// Truncated, retry over TCP
+		if resp, err = dnsExchange(ctx, "tcp", server, query); err != nil {
+			return nil, err
+		}
+	}
+	if len(resp) < 12 || binary.BigEndian.Uint16(resp) != id {
+		return nil, errMalformedDNS
+	}
+	switch rcode := resp[3] & 0x0F; rcode {
+	case 0:
+	case 3:
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: fmt.Sprintf("server misbehaving (rcode %d)", rcode), Name: name, Server: server}
+	}
+	off := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(resp[4:])); i++ {
+		if off, err = skipDNSName(resp, off); err != nil {
+			return nil, err
+		}
+		off += 4
+	}
+	answers := []string{}
+	for i := 0; i < int(binary.BigEndian.Uint16(resp[6:])); i++ {
+		if off, err = skipDNSName(resp, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(resp) {
+			return nil, errMalformedDNS
+		}
+		rtype := binary.BigEndian.Uint16(resp[off:])
+		class := binary.BigEndian.Uint16(resp[off+2:])
+		rdlen := int(binary.BigEndian.Uint16(resp[off+8:]))
+		off += 10
+		if off+rdlen > len(resp) {
+			return nil, errMalformedDNS
+		}
+		if rtype == qtype && class == 1 && (rdlen == net.IPv4len || rdlen == net.IPv6len) {
+			answers = append(answers, net.IP(resp[off:off+rdlen]).String())
+		}
+		off += rdlen
+	}
+	if len(answers) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+	}
+	return answers, nil
+}
+
+// lookup returns the answers for the given name and record type, from the
+// given server (host:port) or the system resolver.
+func lookup(ctx context.Context, server, name, recordType string) ([]string, error) {
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		if recordType == "A" || recordType == "AAAA" {
+			return lookupAddrs(ctx, server, name, recordType)
+		}
+	}
+	resolver := newResolver(server)
+	answers := []string{}
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		mxs, err := resolver.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case "TXT":
+		txts, err := resolver.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, txts...)
+	default:
+		return nil, fmt.Errorf("unsupported record type %q", recordType)
+	}
+	return answers, nil
+}
+
+// normalizeAnswers lowercases the answers, strips the trailing dots and sorts them.
+func normalizeAnswers(answers []string) []string {
+	res := []string{}
+	for _, answer := range answers {
+		res = append(res, strings.TrimSuffix(strings.ToLower(strings.TrimSpace(answer)), "."))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Check performs the DNS query and returns a PingResponse.
+func (dc *DNSChecker) Check(check *Check) (*PingResponse, error) {
+	log.Printf("Checking %v...", check.URL)
+	pr := &PingResponse{
+		URL: check.URL,
+	}
+	u, err := nurl.Parse(check.URL)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	recordType := strings.ToUpper(check.RecordType)
+	if recordType == "" {
+		recordType = "A"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	start := time.Now()
+	answers, err := lookup(ctx, u.Host, name, recordType)
+	elapsed := millis(time.Since(start))
+	pr.Timings = &Timings{DNS: elapsed, Total: elapsed}
+	if err != nil {
+		if isTimeout(err) {
+			pr.Error.Type = "timeout"
+			pr.Error.Error = "timeout exceeded"
+			return pr, nil
+		}
+		pr.Error.Type = "dns"
+		errs := strings.Split(err.Error(), ": ")
+		pr.Error.Error = errs[len(errs)-1]
+		return pr, nil
+	}
+	pr.Answers = normalizeAnswers(answers)
+	if len(check.ExpectedAnswers) > 0 {
+		expected := normalizeAnswers(check.ExpectedAnswers)
+		if strings.Join(expected, "\n") != strings.Join(pr.Answers, "\n") {
+			pr.Error.Type = "assertion"
+			pr.Error.Error = fmt.Sprintf("unexpected %v answers %v (expected %v)", recordType, pr.Answers, expected)
+			return pr, nil
+		}
+	}
+	pr.Up = true
+	return pr, nil
+}
@@ -0,0 +1,214 @@
+package neverdown
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type dnsRecord struct {
+	name  string
+	rtype uint16
+	data  []byte
+}
+
+func encodeDNSName(name string) []byte {
+	buf := []byte{}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
+
+var testZone = []*dnsRecord{
+	{"example.test.", 1, net.ParseIP("192.0.2.1").To4()},
+	{"example.test.", 1, net.ParseIP("192.0.2.2").To4()},
+	{"example.test.", 28, net.ParseIP("2001:db8::1").To16()},
+	{"example.test.", 15, append([]byte{0, 10}, encodeDNSName("mail.example.test.")...)},
+	{"example.test.", 15, append([]byte{0, 20}, encodeDNSName("backup.example.test.")...)},
+	{"example.test.", 16, append([]byte{11}, "v=spf1 -all"...)},
+	{"www.example.test.", 5, encodeDNSName("example.test.")},
+}
+
+// dnsAnswer answers a DNS query from the testZone, CNAMEs are followed.
+func dnsAnswer(query []byte) []byte {
+	// Parse the question (header is 12 bytes)
+	i := 12
+	labels := []string{}
+	for query[i] != 0 {
+		labels = append(labels, string(query[i+1:i+1+int(query[i])]))
+		i += 1 + int(query[i])
+	}
+	name := strings.ToLower(strings.Join(labels, ".")) + "."
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+	question := query[12 : i+5]
+
+	exists := false
+	answers := []*dnsRecord{}
+	for _, rr := range testZone {
+		if rr.name != name {
+			continue
+		}
+		exists = true
+		if rr.rtype == qtype {
+			answers = append(answers, rr)
+		}
+		if rr.rtype == 5 && qtype != 5 {
+			answers = append(answers, rr)
+			target := string(rr.data)
+			for _, trr := range testZone {
+				if string(encodeDNSName(trr.name)) == target && trr.rtype == qtype {
+					answers = append(answers, trr)
+				}
+			}
+		}
+	}
+	rcode := uint16(0)
+	if !exists {
+		// NXDOMAIN
+		rcode = 3
+	}
+	resp := make([]byte, 12)
+	copy(resp, query[:2])
+	// QR, AA, RD (copied) and RA flags
+	binary.BigEndian.PutUint16(resp[2:], 0x8000|0x0400|binary.BigEndian.Uint16(query[2:])&0x0100|0x0080|rcode)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+	resp = append(resp, question...)
+	for _, rr := range answers {
+		resp = append(resp, encodeDNSName(rr.name)...)
+		rrHeader := make([]byte, 10)
+		binary.BigEndian.PutUint16(rrHeader, rr.rtype)
+		binary.BigEndian.PutUint16(rrHeader[2:], 1)
+		binary.BigEndian.PutUint32(rrHeader[4:], 60)
+		binary.BigEndian.PutUint16(rrHeader[8:], uint16(len(rr.data)))
+		resp = append(resp, rrHeader...)
+		resp = append(resp, rr.data...)
+	}
+	return resp
+}
+
+// serveDNS starts a stub DNS server (UDP) answering from the testZone.
+func serveDNS(t *testing.T) (string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start the DNS server: %v", err)
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(dnsAnswer(buf[:n]), addr)
+		}
+	}()
+	return pc.LocalAddr().String(), func() { pc.Close() }
+}
+
+func TestDNSCheck(t *testing.T) {
+	addr, stop := serveDNS(t)
+	defer stop()
+	for _, tc := range []struct {
+		name       string
+		recordType string
+		expected   []string
+		answers    []string
+		up         bool
+		errType    string
+	}{
+		{"example.test", "A", nil, []string{"192.0.2.1", "192.0.2.2"}, true, ""},
+		{"example.test", "A", []string{"192.0.2.2", "192.0.2.1"}, []string{"192.0.2.1", "192.0.2.2"}, true, ""},
+		{"example.test", "A", []string{"192.0.2.3"}, []string{"192.0.2.1", "192.0.2.2"}, false, "assertion"},
+		{"www.example.test", "A", nil, []string{"192.0.2.1", "192.0.2.2"}, true, ""},
+		{"example.test", "AAAA", []string{"2001:DB8::1"}, []string{"2001:db8::1"}, true, ""},
+		{"www.example.test", "CNAME", []string{"example.test."}, []string{"example.test"}, true, ""},
+		{"example.test", "MX", []string{"10 mail.example.test", "20 backup.example.test"}, []string{"10 mail.example.test", "20 backup.example.test"}, true, ""},
+		{"example.test", "TXT", []string{"v=spf1 -all"}, []string{"v=spf1 -all"}, true, ""},
+		{"missing.example.test", "A", nil, nil, false, "dns"},
+		{"missing.example.test", "TXT", nil, nil, false, "dns"},
+	} {
+		check := NewCheck()
+		check.URL = "dns://" + addr + "/" + tc.name
+		check.RecordType = tc.recordType
+		check.ExpectedAnswers = tc.expected
+		if err := check.Validate(); err != nil {
+			t.Fatalf("%v %v: invalid check: %v", tc.recordType, tc.name, err)
+		}
+		pr, err := (&DNSChecker{}).Check(check)
+		if err != nil {
+			t.Fatalf("%v %v: check failed: %v", tc.recordType, tc.name, err)
+		}
+		if pr.Up != tc.up || pr.Error.Type != tc.errType {
+			t.Errorf("%v %v: got up=%v error=%+v", tc.recordType, tc.name, pr.Up, pr.Error)
+		}
+		if tc.answers != nil && strings.Join(pr.Answers, ",") != strings.Join(tc.answers, ",") {
+			t.Errorf("%v %v: got answers %v, expected %v", tc.recordType, tc.name, pr.Answers, tc.answers)
+		}
+		if tc.errType == "dns" && pr.Error.Error != "no such host" {
+			t.Errorf("%v %v: expected NXDOMAIN, got %+v", tc.recordType, tc.name, pr.Error)
+		}
+	}
+}
+
+func TestDNSCheckIgnoresHostsFile(t *testing.T) {
+	addr, stop := serveDNS(t)
+	defer stop()
+	// "localhost" is in /etc/hosts, but not in the zone of the DNS server
+	for _, recordType := range []string{"A", "AAAA"} {
+		check := NewCheck()
+		check.URL = "dns://" + addr + "/localhost"
+		check.RecordType = recordType
+		if err := check.Validate(); err != nil {
+			t.Fatalf("invalid check: %v", err)
+		}
+		pr, err := (&DNSChecker{}).Check(check)
+		if err != nil {
+			t.Fatalf("check failed: %v", err)
+		}
+		if pr.Up || pr.Error.Error != "no such host" {
+			t.Errorf("%v: the server should be queried, got up=%v answers=%v error=%+v", recordType, pr.Up, pr.Answers, pr.Error)
+		}
+	}
+
+	// The check is down if the server doesn't answer
+	stop()
+	dnsTimeout = 500 * time.Millisecond
+	defer func() { dnsTimeout = 10 * time.Second }()
+	check := NewCheck()
+	check.URL = "dns://" + addr + "/localhost"
+	pr, err := (&DNSChecker{}).Check(check)
+	if err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if pr.Up {
+		t.Errorf("the check should be down when the server is down, got answers %v", pr.Answers)
+	}
+}
+
+func TestDNSCheckValidate(t *testing.T) {
+	for _, tc := range []struct {
+		url        string
+		recordType string
+		valid      bool
+	}{
+		{"dns://8.8.8.8:53/example.com", "", true},
+		{"dns:///example.com", "mx", true},
+		{"dns://8.8.8.8:53/", "A", false},
+		{"dns://8.8.8.8:53", "A", false},
+		{"dns:///example.com", "SRV", false},
+		{"dns:///example.com", "bogus", false},
+		{"http://example.com", "A", false},
+	} {
+		check := NewCheck()
+		check.URL = tc.url
+		check.RecordType = tc.recordType
+		if err := check.Validate(); tc.valid != (err == nil) {
+			t.Errorf("%v (%v): unexpected error %v", tc.url, tc.recordType, err)
+		}
+	}
+}
@@ -2,34 +2,175 @@ package neverdown
 
 import (
 	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
 	"log"
+	"net"
+	"net/smtp"
+	"strings"
 	"text/template"
+	"time"
 
 	"github.com/stathat/amzses"
 )
 
-// TODO handle sender email as config
+// Mailer sends the alert emails.
+type Mailer interface {
+	SendMail(to, subject, body string) error
+}
+
+// DefaultMailer is the Mailer used to send alert emails, emails are disabled if nil.
+var DefaultMailer Mailer
+
+// SESMailer sends emails using Amazon SES (credentials are read from the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_KEY environment variables).
+type SESMailer struct {
+	From string
+}
+
+// checkHeaders rejects the header values containing CR or LF (they could
+// inject headers or recipients).
+func checkHeaders(values ...string) error {
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid email header value %q", value)
+		}
+	}
+	return nil
+}
+
+// SendMail implements the Mailer interface.
+func (m *SESMailer) SendMail(to, subject, body string) error {
+	if err := checkHeaders(m.From, to, subject); err != nil {
+		return err
+	}
+	_, err := amzses.SendMail(m.From, to, subject, body)
+	return err
+}
+
+// SMTPMailer sends emails using an SMTP server, the connection is upgraded
+// with STARTTLS if the server supports it (it's required if StartTLS is set).
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	ReplyTo  string
+	StartTLS bool
+}
+
+// SendMail implements the Mailer interface.
+func (m *SMTPMailer) SendMail(to, subject, body string) error {
+	msg, err := m.message(to, subject, body)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+	c, err := smtp.Dial(m.Addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	} else if m.StartTLS {
+		return fmt.Errorf("%v does not support STARTTLS", m.Addr)
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
 
-var alertEmailSubjectTpl = `{{.URL}} is {{ if .Up }} up {{ else }} down {{ end }}`
-var alertEmailBodyTpl = `{{.URL}} is {{ if .Up }} up {{ else }} down {{ end }}`
+// message formats the email headers and body, the header values can't contain CR or LF.
+func (m *SMTPMailer) message(to, subject, body string) ([]byte, error) {
+	if err := checkHeaders(m.From, m.ReplyTo, to, subject); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %v\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %v\r\n", to)
+	if m.ReplyTo != "" {
+		fmt.Fprintf(&buf, "Reply-To: %v\r\n", m.ReplyTo)
+	}
+	fmt.Fprintf(&buf, "Subject: %v\r\n", subject)
+	fmt.Fprintf(&buf, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	return buf.Bytes(), nil
+}
+
+// Email is a queued email, failed emails are retried by the WebHookScheduler.
+type Email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// SendQueuedEmail sends an email queued as a pending WebHook.
+func SendQueuedEmail(payload []byte) error {
+	if DefaultMailer == nil {
+		return fmt.Errorf("no mailer configured")
+	}
+	email := &Email{}
+	if err := json.Unmarshal(payload, email); err != nil {
+		return err
+	}
+	return DefaultMailer.SendMail(email.To, email.Subject, email.Body)
+}
+
+var alertEmailSubjectTpl = template.Must(template.New("alert mail subject").Parse(`{{ if eq .Event "cert_expiring" }}{{.URL}} certificate expires soon{{ else if eq .Event "flapping_start" }}{{.URL}} is flapping{{ else if eq .Event "flapping_stop" }}{{.URL}} stopped flapping, is {{.Status}}{{ else }}{{.URL}} is {{.Status}}{{ end }}`))
+var alertEmailBodyTpl = template.Must(template.New("alert mail body").Parse(`{{ if eq .Event "cert_expiring" }}{{.URL}} certificate ({{.Cert.Subject}}, issued by {{.Cert.Issuer}}) expires on {{.Cert.Expires}}{{ else if eq .Event "flapping_start" }}{{.URL}} is flapping between up and down, notifications are suspended until it stabilizes{{ else if eq .Event "flapping_stop" }}{{.URL}} stopped flapping, is {{.Status}}{{ else }}{{.URL}} is {{.Status}} (was {{.PrevStatus}}){{ end }}`))
 
-func NotifyEmails(c *Check) error {
-	log.Printf("NotifyEmails %v", c)
+// NotifyEmails sends the alert email to every check emails, failed emails
+// will be retried by the WebHookScheduler.
+func NotifyEmails(ra *Raft, whSched *WebHookScheduler, c *Check) error {
+	log.Printf("NotifyEmails %v", c.ID)
+	if DefaultMailer == nil {
+		return fmt.Errorf("no mailer configured")
+	}
 	var body, subject bytes.Buffer
-	t := template.New("alert mail body")
-	t2 := template.New("alert mail subject")
-	template.Must(t.Parse(alertEmailBodyTpl))
-	template.Must(t2.Parse(alertEmailSubjectTpl))
-	if err := t.Execute(&body, c); err != nil {
-		panic(err)
+	if err := alertEmailBodyTpl.Execute(&body, c); err != nil {
+		return err
 	}
-	if err := t2.Execute(&subject, c); err != nil {
-		panic(err)
+	if err := alertEmailSubjectTpl.Execute(&subject, c); err != nil {
+		return err
 	}
 	for _, email := range c.Emails {
 		log.Printf("Sending mail to %v", email)
-		if _, err := amzses.SendMail("thomas.sileo@gmail.com", email, subject.String(), body.String()); err != nil {
-			return err
+		if err := DefaultMailer.SendMail(email, subject.String(), body.String()); err != nil {
+			log.Printf("Failed to send mail to %v for check %v: %v", email, c.ID, err)
+			payload, err := json.Marshal(&Email{To: email, Subject: subject.String(), Body: body.String()})
+			if err != nil {
+				return err
+			}
+			if err := QueueWebHook(ra, whSched, &WebHook{Kind: "email", CheckID: c.ID, URL: "mailto:" + email, Payload: payload, Retry: c.EmailRetry}); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,53 @@
+package neverdown
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSMTPMailerMessage(t *testing.T) {
+	m := &SMTPMailer{From: "neverdown@example.com"}
+	msg, err := m.message("ops@example.com", "example.com is down", "example.com is down (was up)\n")
+	if err != nil {
+		t.Fatalf("failed to format the message: %v", err)
+	}
+	if !bytes.Contains(msg, []byte("To: ops@example.com\r\nSubject: example.com is down\r\n")) {
+		t.Errorf("unexpected message %q", msg)
+	}
+	for _, tc := range []struct{ to, subject string }{
+		{"ops@example.com\r\nBcc: attacker@example.com", "down"},
+		{"ops@example.com", "down\nBcc: attacker@example.com"},
+		{"ops@example.com", "down\r"},
+	} {
+		if _, err := m.message(tc.to, tc.subject, "body"); err == nil {
+			t.Errorf("to=%q subject=%q should be rejected", tc.to, tc.subject)
+		}
+	}
+}
+
+func TestCheckValidateEmails(t *testing.T) {
+	for _, tc := range []struct {
+		email    string
+		expected string
+	}{
+		{"ops@example.com", "ops@example.com"},
+		{"Ops <ops@example.com>", "ops@example.com"},
+		{"ops@example.com\r\nBcc: attacker@example.com", ""},
+		{"ops@example.com, attacker@example.com", ""},
+		{"not an email", ""},
+	} {
+		check := NewCheck()
+		check.URL = "http://example.com"
+		check.Emails = []string{tc.email}
+		err := check.Validate()
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("%q should be rejected", tc.email)
+			}
+			continue
+		}
+		if err != nil || check.Emails[0] != tc.expected {
+			t.Errorf("%q: got %v (%v), expected %v", tc.email, check.Emails, err, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package neverdown
+
+// Flap detection defaults
+var (
+	DefaultFlapWindow    = 20
+	DefaultFlapThreshold = 0.3
+)
+
+// RecordStatus appends the current status to the sliding window of recent statuses.
+func (c *Check) RecordStatus() {
+	if c.FlapWindow <= 0 {
+		c.RecentStatus = nil
+		return
+	}
+	c.RecentStatus = append(c.RecentStatus, c.Status)
+	if len(c.RecentStatus) > c.FlapWindow {
+		c.RecentStatus = c.RecentStatus[len(c.RecentStatus)-c.FlapWindow:]
+	}
+}
+
+// FlapRatio returns the ratio of state changes in the recent statuses, the ratio
+// is computed over the full window so a single change on a new check isn't flapping.
+func (c *Check) FlapRatio() float64 {
+	if len(c.RecentStatus) < 2 || c.FlapWindow < 2 {
+		return 0
+	}
+	changes := 0
+	for i := 1; i < len(c.RecentStatus); i++ {
+		if c.RecentStatus[i] != c.RecentStatus[i-1] {
+			changes++
+		}
+	}
+	return float64(changes) / float64(c.FlapWindow-1)
+}
+
+// DetectFlapping updates the Flapping flag, a check starts flapping when the
+// ratio of state changes exceeds FlapThreshold, and stops flapping when it goes
+// below half the threshold, returns true if the flag changed.
+func (c *Check) DetectFlapping() bool {
+	wasFlapping := c.Flapping
+	if c.FlapWindow <= 0 {
+		c.Flapping = false
+		return wasFlapping
+	}
+	ratio := c.FlapRatio()
+	if c.Flapping {
+		c.Flapping = ratio >= c.FlapThreshold/2
+	} else {
+		c.Flapping = ratio >= c.FlapThreshold
+	}
+	return c.Flapping != wasFlapping
+}
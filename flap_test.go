@@ -0,0 +1,83 @@
+package neverdown
+
+import (
+	"testing"
+)
+
+func TestDetectFlapping(t *testing.T) {
+	check := NewCheck()
+	check.FlapWindow = 5
+	check.FlapThreshold = 0.5
+	for i, step := range []struct {
+		status   string
+		ratio    float64
+		flapping bool
+	}{
+		{StatusUp, 0, false},
+		{StatusDown, 0.25, false},
+		{StatusUp, 0.5, true},
+		{StatusDown, 0.75, true},
+		{StatusUp, 1, true},
+		{StatusUp, 0.75, true},
+		{StatusUp, 0.5, true},
+		// Stops flapping below half the threshold
+		{StatusUp, 0.25, true},
+		{StatusUp, 0, false},
+		{StatusUp, 0, false},
+	} {
+		wasFlapping := check.Flapping
+		check.Status = step.status
+		check.RecordStatus()
+		changed := check.DetectFlapping()
+		if len(check.RecentStatus) > check.FlapWindow {
+			t.Errorf("step %d: %d recent statuses, window is %d", i, len(check.RecentStatus), check.FlapWindow)
+		}
+		if ratio := check.FlapRatio(); ratio != step.ratio {
+			t.Errorf("step %d: got ratio %v, expected %v", i, ratio, step.ratio)
+		}
+		if check.Flapping != step.flapping {
+			t.Errorf("step %d: got flapping %v, expected %v", i, check.Flapping, step.flapping)
+		}
+		if changed != (wasFlapping != step.flapping) {
+			t.Errorf("step %d: DetectFlapping returned %v", i, changed)
+		}
+	}
+}
+
+func TestFlapRatio(t *testing.T) {
+	for _, tc := range []struct {
+		window int
+		recent []string
+		ratio  float64
+	}{
+		{20, nil, 0},
+		{20, []string{StatusUp}, 0},
+		// The ratio is computed over the full window
+		{20, []string{StatusUp, StatusDown}, 1.0 / 19},
+		{3, []string{StatusUp, StatusDegraded, StatusDown}, 1},
+		{3, []string{StatusDown, StatusDown, StatusDown}, 0},
+		{1, []string{StatusDown}, 0},
+	} {
+		check := &Check{FlapWindow: tc.window, RecentStatus: tc.recent}
+		if ratio := check.FlapRatio(); ratio != tc.ratio {
+			t.Errorf("window=%d recent=%v: got ratio %v, expected %v", tc.window, tc.recent, ratio, tc.ratio)
+		}
+	}
+}
+
+func TestFlapDetectionDisabled(t *testing.T) {
+	check := NewCheck()
+	check.RecentStatus = []string{StatusUp, StatusDown, StatusUp}
+	check.Flapping = true
+	check.FlapWindow = 0
+	check.RecordStatus()
+	if check.RecentStatus != nil {
+		t.Errorf("recent statuses should be cleared, got %v", check.RecentStatus)
+	}
+	if !check.DetectFlapping() || check.Flapping {
+		t.Errorf("disabling the flap detection should stop the flapping")
+	}
+	if check.DetectFlapping() {
+		t.Errorf("flapping flag should not change")
+	}
+}
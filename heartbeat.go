@@ -0,0 +1,114 @@
+package neverdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Heartbeat kinds
+const (
+	HeartbeatPing  = "ping"
+	HeartbeatStart = "start"
+	HeartbeatFail  = "fail"
+)
+
+// Heartbeat is a ping received from a monitored job (cron jobs, batch workers...).
+type Heartbeat struct {
+	CheckID string `json:"check_id"`
+	Kind    string `json:"kind"`
+	Time    int64  `json:"time"`
+	Message string `json:"message,omitempty"`
+}
+
+// NewHeartbeat initializes a Heartbeat received now.
+func NewHeartbeat(checkID, kind string) *Heartbeat {
+	return &Heartbeat{
+		CheckID: checkID,
+		Kind:    kind,
+		Time:    time.Now().UTC().Unix(),
+	}
+}
+
+// ToCmd serializes a Heartbeat into a raft command.
+func (hb *Heartbeat) ToCmd() []byte {
+	js, err := json.Marshal(hb)
+	if err != nil {
+		panic(err)
+	}
+	msg := make([]byte, len(js)+1)
+	msg[0] = 4
+	copy(msg[1:], js)
+	return msg
+}
+
+// Apply records the heartbeat on the check.
+func (hb *Heartbeat) Apply(check *Check) error {
+	switch hb.Kind {
+	case HeartbeatPing:
+		if check.LastStart != 0 && check.LastStart > check.LastHeartbeat {
+			check.LastDuration = hb.Time - check.LastStart
+		}
+		check.LastHeartbeat = hb.Time
+	case HeartbeatStart:
+		check.LastStart = hb.Time
+	case HeartbeatFail:
+		check.LastFail = hb.Time
+		check.LastFailMessage = hb.Message
+	default:
+		return fmt.Errorf("unknown heartbeat kind %q", hb.Kind)
+	}
+	return nil
+}
+
+// mergeHeartbeats keeps the most recent heartbeats from the other check,
+// heartbeats may be received while the check is being performed.
+func (c *Check) mergeHeartbeats(other *Check) {
+	if other.LastHeartbeat > c.LastHeartbeat {
+		c.LastHeartbeat = other.LastHeartbeat
+		c.LastDuration = other.LastDuration
+	}
+	if other.LastStart > c.LastStart {
+		c.LastStart = other.LastStart
+	}
+	if other.LastFail > c.LastFail {
+		c.LastFail = other.LastFail
+		c.LastFailMessage = other.LastFailMessage
+	}
+}
+
+// HeartbeatChecker checks that a heartbeat has been received in the last
+// Interval + Grace seconds (dead man's switch).
+type HeartbeatChecker struct{}
+
+// Check returns a PingResponse given the last received heartbeats.
+func (hc *HeartbeatChecker) Check(check *Check) (*PingResponse, error) {
+	pr := &PingResponse{
+		URL: check.URL,
+	}
+	if check.LastFail != 0 && check.LastFail >= check.LastHeartbeat {
+		pr.Error.Type = "heartbeat"
+		pr.Error.Error = "job reported a failure"
+		if check.LastFailMessage != "" {
+			pr.Error.Error = check.LastFailMessage
+		}
+		return pr, nil
+	}
+	last := check.LastHeartbeat
+	if last == 0 {
+		// No heartbeat received yet, wait for a full period after the first check
+		last = check.FirstCheck
+	}
+	if last == 0 {
+		pr.Up = true
+		return pr, nil
+	}
+	deadline := time.Unix(last, 0).Add(time.Duration(check.Interval+check.Grace) * time.Second)
+	if time.Now().After(deadline) {
+		pr.Error.Type = "heartbeat"
+		pr.Error.Error = fmt.Sprintf("no heartbeat received since %v", time.Unix(last, 0).UTC().Format(time.RFC3339))
+		return pr, nil
+	}
+	pr.Up = true
+	return pr, nil
+}
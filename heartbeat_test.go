@@ -0,0 +1,79 @@
+package neverdown
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatCheck(t *testing.T) {
+	now := time.Now().UTC().Unix()
+	for _, tc := range []struct {
+		name          string
+		firstCheck    int64
+		lastHeartbeat int64
+		lastFail      int64
+		up            bool
+	}{
+		{"never checked", 0, 0, 0, true},
+		{"waiting for the first heartbeat", now - 60, 0, 0, true},
+		{"first heartbeat missed", now - 200, 0, 0, false},
+		{"heartbeat received", now - 3600, now - 30, 0, true},
+		{"within the grace period", now - 3600, now - 80, 0, true},
+		{"heartbeat missed", now - 3600, now - 100, 0, false},
+		{"job failed", now - 3600, now - 30, now - 10, false},
+		{"job succeeded after a failure", now - 3600, now - 10, now - 30, true},
+	} {
+		check := NewCheck()
+		check.Type = "heartbeat"
+		check.Interval = 60
+		check.Grace = 30
+		check.FirstCheck = tc.firstCheck
+		check.LastHeartbeat = tc.lastHeartbeat
+		check.LastFail = tc.lastFail
+		pr, err := PerformCheck(check)
+		if err != nil {
+			t.Fatalf("%v: check failed: %v", tc.name, err)
+		}
+		if pr.Up != tc.up {
+			t.Errorf("%v: got up=%v (%+v)", tc.name, pr.Up, pr.Error)
+		}
+		if !pr.Up && pr.Error.Type != "heartbeat" {
+			t.Errorf("%v: expected a heartbeat error, got %+v", tc.name, pr.Error)
+		}
+	}
+}
+
+func TestHeartbeatApply(t *testing.T) {
+	s := NewStore()
+	check := NewCheck()
+	check.ID = "job"
+	check.Type = "heartbeat"
+	if err := s.ExecCommand(check.ToPostCmd()); err != nil {
+		t.Fatalf("failed to apply the check: %v", err)
+	}
+	for _, hb := range []*Heartbeat{
+		&Heartbeat{CheckID: check.ID, Kind: HeartbeatStart, Time: 1000},
+		&Heartbeat{CheckID: check.ID, Kind: HeartbeatPing, Time: 1090},
+		&Heartbeat{CheckID: check.ID, Kind: HeartbeatFail, Time: 1100, Message: "exit status 1"},
+	} {
+		if err := s.ExecCommand(hb.ToCmd()); err != nil {
+			t.Fatalf("failed to apply the heartbeat: %v", err)
+		}
+	}
+	stored := s.Check(check.ID)
+	if stored.LastHeartbeat != 1090 || stored.LastDuration != 90 || stored.LastFail != 1100 || stored.LastFailMessage != "exit status 1" {
+		t.Errorf("unexpected heartbeats %+v", stored)
+	}
+	if err := s.ExecCommand((&Heartbeat{CheckID: "unknown", Kind: HeartbeatPing, Time: 1}).ToCmd()); err == nil {
+		t.Errorf("heartbeat for an unknown check should fail")
+	}
+
+	// The heartbeats received while the check was performed are kept
+	check.LastHeartbeat = 1000
+	if err := s.ExecCommand(check.ToPostCmd()); err != nil {
+		t.Fatalf("failed to apply the check: %v", err)
+	}
+	if stored := s.Check(check.ID); stored.LastHeartbeat != 1090 || stored.LastFail != 1100 {
+		t.Errorf("heartbeats lost %+v", stored)
+	}
+}
@@ -0,0 +1,133 @@
+package neverdown
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// MaxHistory is the maximum number of results kept per check (7 days with the default interval).
+var MaxHistory = 10080
+
+// Results are buffered by the leader and replicated in batches, every
+// HistoryFlushInterval or when HistoryBatchSize results are buffered.
+var (
+	HistoryFlushInterval = time.Minute
+	HistoryBatchSize     = 100
+)
+
+// Result is a single ping result, stored in the check history.
+type Result struct {
+	CheckID string     `json:"check_id"`
+	Time    int64      `json:"time"`
+	Up      bool       `json:"up"`
+	Status  string     `json:"status"`
+	Latency float64    `json:"latency_ms"`
+	Error   *PingError `json:"error,omitempty"`
+	Node    string     `json:"node"`
+}
+
+// NewResult initializes a Result from a PingResponse, Status is the check status after the ping.
+func NewResult(check *Check, pr *PingResponse, now int64) *Result {
+	res := &Result{
+		CheckID: check.ID,
+		Time:    now,
+		Up:      pr.Up,
+		Status:  check.Status,
+		Node:    pr.Node,
+	}
+	if pr.Timings != nil {
+		res.Latency = pr.Timings.Total
+	}
+	if !pr.Up {
+		perr := pr.Error.Truncated()
+		res.Error = &perr
+	}
+	return res
+}
+
+// ToCmd serializes a Result into a raft command.
+func (res *Result) ToCmd() []byte {
+	js, err := json.Marshal(res)
+	if err != nil {
+		panic(err)
+	}
+	msg := make([]byte, len(js)+1)
+	msg[0] = 5
+	copy(msg[1:], js)
+	return msg
+}
+
+// Results is a batch of results.
+type Results []*Result
+
+// ToCmd serializes a batch of results into a single raft command.
+func (results Results) ToCmd() []byte {
+	js, err := json.Marshal(results)
+	if err != nil {
+		panic(err)
+	}
+	msg := make([]byte, len(js)+1)
+	msg[0] = 10
+	copy(msg[1:], js)
+	return msg
+}
+
+// HistoryBuffer buffers the ping results so they're replicated in batches
+// instead of one raft command per ping.
+type HistoryBuffer struct {
+	mu      sync.Mutex
+	results Results
+}
+
+// Add buffers a result, returns true if the batch is full and should be flushed.
+func (b *HistoryBuffer) Add(res *Result) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.results = append(b.results, res)
+	return len(b.results) >= HistoryBatchSize
+}
+
+// Flush replicates the buffered results, they're dropped if the command fails
+// (the node lost the leadership).
+func (b *HistoryBuffer) Flush(ra *Raft) {
+	b.mu.Lock()
+	results := b.results
+	b.results = nil
+	b.mu.Unlock()
+	if len(results) == 0 {
+		return
+	}
+	if err := ra.ExecCommand(results.ToCmd()); err != nil {
+		log.Printf("Failed to replicate %d results: %v", len(results), err)
+	}
+}
+
+// AddResult appends a result to the check history, only the last MaxHistory results are kept.
+// Results of unknown checks are dropped (a batch flushed after the check was deleted).
+func (s *Store) AddResult(res *Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.ChecksIndex[res.CheckID]; !exists {
+		return
+	}
+	history := append(s.HistoryIndex[res.CheckID], res)
+	if len(history) > MaxHistory {
+		history = append([]*Result{}, history[len(history)-MaxHistory:]...)
+	}
+	s.HistoryIndex[res.CheckID] = history
+}
+
+// History returns the results of the given check between from and to (Unix timestamps, 0 to ignore).
+func (s *Store) History(checkID string, from, to int64) []*Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := []*Result{}
+	for _, res := range s.HistoryIndex[checkID] {
+		if (from == 0 || res.Time >= from) && (to == 0 || res.Time <= to) {
+			results = append(results, res)
+		}
+	}
+	return results
+}
@@ -0,0 +1,58 @@
+package neverdown
+
+import (
+	"testing"
+)
+
+func TestResultsBatch(t *testing.T) {
+	buf := &HistoryBuffer{}
+	for i := 1; i <= HistoryBatchSize; i++ {
+		full := buf.Add(&Result{CheckID: "batch", Time: int64(i), Up: true, Status: StatusUp})
+		if full != (i == HistoryBatchSize) {
+			t.Fatalf("result %d: unexpected full=%v", i, full)
+		}
+	}
+	s := NewStore()
+	check := NewCheck()
+	check.ID = "batch"
+	if err := s.ExecCommand(check.ToPostCmd()); err != nil {
+		t.Fatalf("failed to apply the check: %v", err)
+	}
+	if err := s.ExecCommand(buf.results.ToCmd()); err != nil {
+		t.Fatalf("failed to apply the batch: %v", err)
+	}
+	history := s.History("batch", 0, 0)
+	if len(history) != HistoryBatchSize {
+		t.Fatalf("expected %d results, got %d", HistoryBatchSize, len(history))
+	}
+	if history[0].Time != 1 || history[len(history)-1].Time != int64(HistoryBatchSize) {
+		t.Errorf("results out of order")
+	}
+	if res := s.History("batch", 10, 19); len(res) != 10 {
+		t.Errorf("expected 10 results between 10 and 19, got %d", len(res))
+	}
+}
+
+func TestResultsDeletedCheck(t *testing.T) {
+	s := NewStore()
+	check := NewCheck()
+	check.ID = "deleted"
+	if err := s.ExecCommand(check.ToPostCmd()); err != nil {
+		t.Fatalf("failed to apply the check: %v", err)
+	}
+	results := Results{&Result{CheckID: check.ID, Time: 1}}
+	if err := s.ExecCommand(results.ToCmd()); err != nil {
+		t.Fatalf("failed to apply the batch: %v", err)
+	}
+	if err := s.ExecCommand(append([]byte{1}, check.ID...)); err != nil {
+		t.Fatalf("failed to delete the check: %v", err)
+	}
+	// The results buffered before the check was deleted are dropped
+	results = Results{&Result{CheckID: check.ID, Time: 2}, &Result{CheckID: "unknown", Time: 2}}
+	if err := s.ExecCommand(results.ToCmd()); err != nil {
+		t.Fatalf("failed to apply the batch: %v", err)
+	}
+	if len(s.HistoryIndex) != 0 {
+		t.Errorf("orphan history %v", s.HistoryIndex)
+	}
+}
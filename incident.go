@@ -0,0 +1,164 @@
+package neverdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// MaxIncidentAge is the number of seconds resolved incidents are kept (400 days,
+// so the monthly SLA of the last year can be computed).
+var MaxIncidentAge int64 = 400 * 86400
+
+// Incident represents a down->up cycle of a check.
+type Incident struct {
+	ID      string `json:"id"`
+	CheckID string `json:"check_id"`
+	URL     string `json:"url"`
+	Start   int64  `json:"start"`
+	// End is 0 while the incident is ongoing
+	End      int64      `json:"end"`
+	Duration int64      `json:"duration"`
+	Error    *PingError `json:"error"`
+	// Responses contains the leader response and the confirming followers responses
+	Responses     []*PingResponse  `json:"responses"`
+	Notifications []*Notification  `json:"notifications"`
+	Timeline      []*TimelineEntry `json:"timeline"`
+}
+
+// Notification is a notification sent for a check event.
+type Notification struct {
+	Time    int64  `json:"time"`
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Error   string `json:"error,omitempty"`
+}
+
+// TimelineEntry is an event in the life of an incident.
+type TimelineEntry struct {
+	Time    int64  `json:"time"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// NewIncident opens an incident for the given check, prs[0] is the leader response.
+func NewIncident(check *Check, prs []*PingResponse, now int64) *Incident {
+	incident := &Incident{
+		ID:            uuid(),
+		CheckID:       check.ID,
+		URL:           check.URL,
+		Start:         now,
+		Responses:     prs,
+		Notifications: []*Notification{},
+		Timeline:      []*TimelineEntry{},
+	}
+	for _, pr := range prs {
+		pr.Error = pr.Error.Truncated()
+	}
+	if len(prs) > 0 {
+		perr := prs[0].Error
+		incident.Error = &perr
+		incident.AddEntry(now, "down", fmt.Sprintf("%v is down (%v: %v)", check.URL, perr.Type, perr.Error))
+		for _, pr := range prs[1:] {
+			incident.AddEntry(now, "confirmation", fmt.Sprintf("%v confirmed the outage (%v: %v)", pr.Node, pr.Error.Type, pr.Error.Error))
+		}
+	}
+	return incident
+}
+
+// AddEntry appends an entry to the incident timeline.
+func (i *Incident) AddEntry(now int64, entryType, message string) {
+	i.Timeline = append(i.Timeline, &TimelineEntry{
+		Time:    now,
+		Type:    entryType,
+		Message: message,
+	})
+}
+
+// AddNotifications records the notifications sent during the incident.
+func (i *Incident) AddNotifications(notifications []*Notification) {
+	for _, n := range notifications {
+		i.Notifications = append(i.Notifications, n)
+		msg := fmt.Sprintf("%v notification sent (%v)", n.Channel, n.Event)
+		if n.Error != "" {
+			msg = fmt.Sprintf("%v notification failed (%v): %v", n.Channel, n.Event, n.Error)
+		}
+		i.AddEntry(n.Time, "notification", msg)
+	}
+}
+
+// Copy returns a copy of the incident that can be modified (the stored
+// incidents are only modified through raft). The responses, notifications and
+// timeline entries are shared, entries are only appended.
+func (i *Incident) Copy() *Incident {
+	incident := *i
+	incident.Responses = append([]*PingResponse{}, i.Responses...)
+	incident.Notifications = append([]*Notification{}, i.Notifications...)
+	incident.Timeline = append([]*TimelineEntry{}, i.Timeline...)
+	return &incident
+}
+
+// Resolve closes the incident.
+func (i *Incident) Resolve(check *Check, now int64) {
+	i.End = now
+	i.Duration = now - i.Start
+	i.AddEntry(now, "up", fmt.Sprintf("%v is %v", check.URL, check.Status))
+}
+
+// ToPostCmd serializes an Incident into a raft POST command.
+func (i *Incident) ToPostCmd() []byte {
+	js, err := json.Marshal(i)
+	if err != nil {
+		panic(err)
+	}
+	msg := make([]byte, len(js)+1)
+	msg[0] = 6
+	copy(msg[1:], js)
+	return msg
+}
+
+type incidentByStart []*Incident
+
+func (s incidentByStart) Len() int           { return len(s) }
+func (s incidentByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s incidentByStart) Less(i, j int) bool { return s[i].Start > s[j].Start }
+
+// Incidents returns the incidents of the given check (or all incidents if
+// checkID is empty), most recent first, they're copies like Incident.
+func (s *Store) Incidents(checkID string) []*Incident {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	incidents := []*Incident{}
+	for _, incident := range s.IncidentsIndex {
+		if checkID == "" || incident.CheckID == checkID {
+			incidents = append(incidents, incident.Copy())
+		}
+	}
+	sort.Sort(incidentByStart(incidents))
+	return incidents
+}
+
+// Incident returns a copy of the incident with the given ID, or nil.
+func (s *Store) Incident(id string) *Incident {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	incident, ok := s.IncidentsIndex[id]
+	if !ok {
+		return nil
+	}
+	return incident.Copy()
+}
+
+// AddIncident stores (or updates) an incident, and prunes the check incidents
+// resolved more than MaxIncidentAge before it started (the incident start is
+// used instead of the current time so every node prunes the same incidents).
+func (s *Store) AddIncident(incident *Incident) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.IncidentsIndex[incident.ID] = incident
+	for id, old := range s.IncidentsIndex {
+		if old.CheckID == incident.CheckID && old.End != 0 && old.End < incident.Start-MaxIncidentAge {
+			delete(s.IncidentsIndex, id)
+		}
+	}
+}
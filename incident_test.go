@@ -0,0 +1,57 @@
+package neverdown
+
+import (
+	"testing"
+)
+
+func TestStoreIncidentCopy(t *testing.T) {
+	s := NewStore()
+	check := NewCheck()
+	check.ID = "incident"
+	check.URL = "http://example.com"
+	incident := NewIncident(check, []*PingResponse{&PingResponse{Node: "leader", Error: PingError{Type: "server"}}}, 1000)
+	if err := s.ExecCommand(incident.ToPostCmd()); err != nil {
+		t.Fatalf("failed to apply the incident: %v", err)
+	}
+	stored := s.Incident(incident.ID)
+	stored.AddNotifications([]*Notification{&Notification{Time: 1001, Event: EventStatus, Channel: "slack"}})
+	stored.Resolve(check, 1060)
+	if fsm := s.IncidentsIndex[incident.ID]; fsm.End != 0 || len(fsm.Notifications) != 0 || len(fsm.Timeline) != 1 {
+		t.Errorf("the stored incident was modified: %+v", fsm)
+	}
+	if err := s.ExecCommand(stored.ToPostCmd()); err != nil {
+		t.Fatalf("failed to apply the incident: %v", err)
+	}
+	if fsm := s.Incident(incident.ID); fsm.End != 1060 || len(fsm.Notifications) != 1 {
+		t.Errorf("the incident was not updated: %+v", fsm)
+	}
+	listed := s.Incidents(check.ID)[0]
+	listed.End = 0
+	listed.AddEntry(1070, "note", "modified")
+	if fsm := s.IncidentsIndex[incident.ID]; fsm.End != 1060 || len(fsm.Timeline) != 3 {
+		t.Errorf("the listed incident should be a copy: %+v", fsm)
+	}
+}
+
+func TestStoreIncidentPruning(t *testing.T) {
+	s := NewStore()
+	old := &Incident{ID: "old", CheckID: "a", Start: 100, End: 200}
+	ongoing := &Incident{ID: "ongoing", CheckID: "a", Start: 150}
+	other := &Incident{ID: "other", CheckID: "b", Start: 100, End: 200}
+	for _, incident := range []*Incident{old, ongoing, other} {
+		s.AddIncident(incident)
+	}
+	s.AddIncident(&Incident{ID: "recent", CheckID: "a", Start: 200 + MaxIncidentAge})
+	if s.Incident("old") == nil {
+		t.Errorf("incident resolved MaxIncidentAge ago should be kept")
+	}
+	s.AddIncident(&Incident{ID: "new", CheckID: "a", Start: 201 + MaxIncidentAge})
+	if s.Incident("old") != nil {
+		t.Errorf("old incident should be pruned")
+	}
+	for _, id := range []string{"ongoing", "other", "recent", "new"} {
+		if s.Incident(id) == nil {
+			t.Errorf("incident %v should be kept", id)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package neverdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Process counters exported on /metrics
+var (
+	webhookAttempts uint64
+	webhookFailures uint64
+	webhookRetries  uint64
+	raftApplies     uint64
+	raftApplyNanos  uint64
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels are the labels set by the exporter.
+var reservedLabels = map[string]bool{"check_id": true, "phase": true, "window": true}
+
+// ValidateLabels checks that the label names are valid Prometheus label names,
+// and don't override the exporter labels.
+func ValidateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if reservedLabels[name] {
+			return fmt.Errorf("label name %q is reserved", name)
+		}
+	}
+	return nil
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsWriter writes metrics using the Prometheus text format.
+type metricsWriter struct {
+	buf      bytes.Buffer
+	families map[string]bool
+}
+
+func (mw *metricsWriter) write(name, help, metricType string, labels map[string]string, value float64) {
+	if mw.families == nil {
+		mw.families = map[string]bool{}
+	}
+	if !mw.families[name] {
+		fmt.Fprintf(&mw.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+		mw.families[name] = true
+	}
+	mw.buf.WriteString(name)
+	if len(labels) > 0 {
+		names := []string{}
+		for label := range labels {
+			names = append(names, label)
+		}
+		sort.Strings(names)
+		pairs := []string{}
+		for _, label := range names {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, labelValueReplacer.Replace(labels[label])))
+		}
+		mw.buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	fmt.Fprintf(&mw.buf, " %v\n", value)
+}
+
+// writeSummary writes the sum and count of a summary without quantiles.
+func (mw *metricsWriter) writeSummary(name, help string, sum float64, count uint64) {
+	fmt.Fprintf(&mw.buf, "# HELP %s %s\n# TYPE %s summary\n", name, help, name)
+	fmt.Fprintf(&mw.buf, "%s_sum %v\n%s_count %v\n", name, sum, name, count)
+}
+
+// checkLabels returns the labels of the check metrics, extra labels are added.
+func checkLabels(check *Check, extra ...string) map[string]string {
+	labels := map[string]string{"check_id": check.ID}
+	for name, value := range check.Labels {
+		labels[name] = value
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels[extra[i]] = extra[i+1]
+	}
+	return labels
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// WriteMetrics writes the checks, webhooks and cluster metrics.
+func WriteMetrics(mw *metricsWriter, leader bool, ra *Raft) {
+	now := time.Now().UTC()
+	checks := ra.Store.Checks()
+	sort.Sort(byID(checks))
+	// Gauges must be grouped by metric family
+	for _, check := range checks {
+		mw.write("neverdown_check_up", "Whether the check is up (1) or down (0).", "gauge", checkLabels(check), boolToFloat(check.Up))
+	}
+	for _, check := range checks {
+		mw.write("neverdown_check_degraded", "Whether the check is degraded.", "gauge", checkLabels(check), boolToFloat(check.Status == StatusDegraded))
+	}
+	for _, check := range checks {
+		mw.write("neverdown_check_flapping", "Whether the check is flapping.", "gauge", checkLabels(check), boolToFloat(check.Flapping))
+	}
+	for _, check := range checks {
+		if check.Timings == nil {
+			continue
+		}
+		for _, phase := range []struct {
+			name  string
+			value float64
+		}{
+			{"dns", check.Timings.DNS},
+			{"connect", check.Timings.Connect},
+			{"tls", check.Timings.TLS},
+			{"ttfb", check.Timings.TTFB},
+			{"total", check.Timings.Total},
+		} {
+			mw.write("neverdown_check_latency_seconds", "Latency of the last check by phase.", "gauge", checkLabels(check, "phase", phase.name), phase.value/1000)
+		}
+	}
+	for _, check := range checks {
+		mw.write("neverdown_check_uptime_percent", "Uptime percentage of the check.", "gauge", checkLabels(check, "window", "all"), float64(check.Uptime))
+		for _, window := range UptimeWindows {
+			if uptime, ok := check.Uptimes[window]; ok {
+				mw.write("neverdown_check_uptime_percent", "Uptime percentage of the check.", "gauge", checkLabels(check, "window", window), uptime)
+			}
+		}
+	}
+	for _, check := range checks {
+		if check.Cert == nil {
+			continue
+		}
+		expiry := time.Unix(check.Cert.NotAfter, 0).Sub(now).Seconds()
+		mw.write("neverdown_check_cert_expiry_seconds", "Seconds until the peer certificate chain expires.", "gauge", checkLabels(check), expiry)
+	}
+	for _, check := range checks {
+		mw.write("neverdown_check_pings_total", "Number of pings performed.", "counter", checkLabels(check), float64(check.Pings))
+	}
+	for _, check := range checks {
+		mw.write("neverdown_check_outages_total", "Number of outages.", "counter", checkLabels(check), float64(check.Outages))
+	}
+
+	mw.write("neverdown_webhook_attempts_total", "Number of webhook delivery attempts.", "counter", nil, float64(atomic.LoadUint64(&webhookAttempts)))
+	mw.write("neverdown_webhook_failures_total", "Number of failed webhook deliveries.", "counter", nil, float64(atomic.LoadUint64(&webhookFailures)))
+	mw.write("neverdown_webhook_retries_total", "Number of webhook retries.", "counter", nil, float64(atomic.LoadUint64(&webhookRetries)))
+	mw.write("neverdown_pending_webhooks", "Number of pending webhooks.", "gauge", nil, float64(len(ra.Store.PendingWebHooks())))
+	mw.write("neverdown_dead_webhooks", "Number of webhooks in the dead-letter queue.", "gauge", nil, float64(len(ra.Store.DeadWebHooks())))
+
+	mw.write("neverdown_is_leader", "Whether the node is the raft leader.", "gauge", nil, boolToFloat(leader))
+	mw.write("neverdown_peers", "Number of peers in the raft cluster.", "gauge", nil, float64(len(ra.PeersAPI())))
+	mw.writeSummary("neverdown_raft_apply_duration_seconds", "Time spent applying raft commands.", float64(atomic.LoadUint64(&raftApplyNanos))/1e9, atomic.LoadUint64(&raftApplies))
+}
+
+type byID []*Check
+
+func (s byID) Len() int           { return len(s) }
+func (s byID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byID) Less(i, j int) bool { return s[i].ID < s[j].ID }
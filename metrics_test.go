@@ -0,0 +1,28 @@
+package neverdown
+
+import (
+	"testing"
+)
+
+func TestValidateLabels(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		valid bool
+	}{
+		{"team", true},
+		{"_env", true},
+		{"env2", true},
+		{"check_id", false},
+		{"phase", false},
+		{"window", false},
+		{"__name", false},
+		{"2env", false},
+		{"team-name", false},
+		{"", false},
+	} {
+		err := ValidateLabels(map[string]string{tc.name: "value"})
+		if tc.valid != (err == nil) {
+			t.Errorf("label %q: unexpected error %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package neverdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+var PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyEvent is a PagerDuty Events API v2 event.
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+}
+
+// PagerDutyPayload describes the alert of a "trigger" event.
+type PagerDutyPayload struct {
+	Summary       string      `json:"summary"`
+	Source        string      `json:"source"`
+	Severity      string      `json:"severity"`
+	Timestamp     string      `json:"timestamp"`
+	Component     string      `json:"component,omitempty"`
+	CustomDetails interface{} `json:"custom_details,omitempty"`
+}
+
+// PagerDutyDedupKey returns the dedup key of the check alerts, the "resolve"
+// event closes the alert opened by the "trigger" event.
+func PagerDutyDedupKey(check *Check) string {
+	return fmt.Sprintf("neverdown-%v", check.ID)
+}
+
+// PagerDutyAction returns the event action for the check status change
+// (PrevStatus to Status), "trigger" on up->down, "resolve" on down->up, and an
+// empty string if PagerDuty shouldn't be notified. The action doesn't depend on
+// the event, so the transitions are also sent while the check is flapping.
+func PagerDutyAction(check *Check) string {
+	switch {
+	case check.Status == StatusDown && check.PrevStatus != StatusDown:
+		return "trigger"
+	case check.Status != StatusDown && check.PrevStatus == StatusDown:
+		return "resolve"
+	}
+	return ""
+}
+
+// NewPagerDutyEvent returns the event for the given action.
+func NewPagerDutyEvent(check *Check, action string) *PagerDutyEvent {
+	event := &PagerDutyEvent{
+		RoutingKey:  check.PagerDuty,
+		EventAction: action,
+		DedupKey:    PagerDutyDedupKey(check),
+	}
+	if action == "trigger" {
+		source := check.URL
+		if source == "" {
+			source = check.ID
+		}
+		summary := fmt.Sprintf("%v is down", check.DisplayName())
+		if perr, ok := check.LastError.(PingError); ok && perr.Error != "" {
+			summary = fmt.Sprintf("%v: %v", summary, perr.Error)
+		}
+		event.Payload = &PagerDutyPayload{
+			Summary:   summary,
+			Source:    source,
+			Severity:  "critical",
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Component: check.Component,
+			CustomDetails: map[string]interface{}{
+				"check_id":   check.ID,
+				"url":        check.URL,
+				"last_error": check.LastError,
+				"incident":   check.IncidentID,
+			},
+		}
+	}
+	return event
+}
+
+// stalePagerDutyEvents returns the queued PagerDuty events of the check, they
+// are superseded by a new event (a retried "trigger" would re-open a resolved alert).
+func stalePagerDutyEvents(pending []*WebHook, check *Check) []*WebHook {
+	stale := []*WebHook{}
+	for _, wh := range pending {
+		if wh.Kind != "pagerduty" || wh.CheckID != check.ID {
+			continue
+		}
+		event := &PagerDutyEvent{}
+		if err := json.Unmarshal(wh.Payload, event); err != nil || event.DedupKey != PagerDutyDedupKey(check) {
+			continue
+		}
+		stale = append(stale, wh)
+	}
+	return stale
+}
+
+// NotifyPagerDuty sends a "trigger" or "resolve" event to PagerDuty, the queued
+// events for the same dedup key are dropped, failed deliveries are retried by
+// the WebHookScheduler.
+func NotifyPagerDuty(ra *Raft, whSched *WebHookScheduler, check *Check, action string) error {
+	log.Printf("NotifyPagerDuty %v (%v)", check.ID, action)
+	payload, err := json.Marshal(NewPagerDutyEvent(check, action))
+	if err != nil {
+		return err
+	}
+	if stale := stalePagerDutyEvents(ra.Store.PendingWebHooks(), check); len(stale) > 0 {
+		for _, wh := range stale {
+			log.Printf("Dropping queued PagerDuty event %v for check %v", wh.ID, check.ID)
+			if err := ra.ExecCommand(wh.ToDeleteCmd()); err != nil {
+				return err
+			}
+		}
+		if err := whSched.Reload(); err != nil {
+			return err
+		}
+	}
+	wh := &WebHook{Kind: "pagerduty", CheckID: check.ID, URL: PagerDutyEventsURL, Payload: payload, Retry: check.PagerDutyRetry}
+	if err := DeliverWebHook(ra, wh); err != nil {
+		log.Printf("Failed to notify PagerDuty for check %v: %v", check.ID, err)
+		return QueueWebHook(ra, whSched, wh)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package neverdown
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPagerDutyAction(t *testing.T) {
+	for _, tc := range []struct {
+		event, prev, status string
+		expected            string
+	}{
+		{EventStatus, StatusUp, StatusDown, "trigger"},
+		{EventStatus, "", StatusDown, "trigger"},
+		{EventStatus, StatusDegraded, StatusDown, "trigger"},
+		{EventStatus, StatusDown, StatusUp, "resolve"},
+		{EventStatus, StatusDown, StatusDegraded, "resolve"},
+		{EventStatus, StatusUp, StatusDegraded, ""},
+		{EventStatus, StatusDown, StatusDown, ""},
+		// The transitions on the rounds starting/stopping the flapping
+		{EventFlappingStart, StatusUp, StatusDown, "trigger"},
+		{EventFlappingStop, StatusDown, StatusUp, "resolve"},
+		{EventCertExpiring, StatusUp, StatusUp, ""},
+	} {
+		check := NewCheck()
+		check.Event = tc.event
+		check.PrevStatus = tc.prev
+		check.Status = tc.status
+		if action := PagerDutyAction(check); action != tc.expected {
+			t.Errorf("%v %v->%v: got action %q, expected %q", tc.event, tc.prev, tc.status, action, tc.expected)
+		}
+	}
+}
+
+func TestPagerDutyEvents(t *testing.T) {
+	events := []*PagerDutyEvent{}
+	status := http.StatusAccepted
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("bad content type %q", ct)
+		}
+		event := &PagerDutyEvent{}
+		if err := json.NewDecoder(r.Body).Decode(event); err != nil {
+			t.Errorf("failed to decode the event: %v", err)
+		}
+		events = append(events, event)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"status":"success","dedup_key":"` + event.DedupKey + `"}`))
+	}))
+	defer ts.Close()
+
+	check := NewCheck()
+	check.ID = "pd"
+	check.URL = "http://example.com"
+	check.PagerDuty = "R0UT1NGK3Y"
+	check.LastError = PingError{Type: "server", Error: "connection refused"}
+	for _, action := range []string{"trigger", "resolve"} {
+		payload, err := json.Marshal(NewPagerDutyEvent(check, action))
+		if err != nil {
+			t.Fatalf("failed to marshal the event: %v", err)
+		}
+		if _, _, err := SendWebHook(&WebHook{Kind: "pagerduty", URL: ts.URL, Payload: payload}); err != nil {
+			t.Fatalf("failed to send the %v event: %v", action, err)
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	trigger, resolve := events[0], events[1]
+	if trigger.EventAction != "trigger" || resolve.EventAction != "resolve" {
+		t.Errorf("bad actions %q, %q", trigger.EventAction, resolve.EventAction)
+	}
+	for _, event := range events {
+		if event.RoutingKey != "R0UT1NGK3Y" || event.DedupKey != "neverdown-pd" {
+			t.Errorf("bad routing/dedup key %+v", event)
+		}
+	}
+	if trigger.Payload == nil || trigger.Payload.Summary != "pd is down: connection refused" || trigger.Payload.Severity != "critical" {
+		t.Errorf("bad trigger payload %+v", trigger.Payload)
+	}
+	if resolve.Payload != nil {
+		t.Errorf("resolve event should not have a payload, got %+v", resolve.Payload)
+	}
+
+	// Rate limited events must be retried
+	status = http.StatusTooManyRequests
+	payload, _ := json.Marshal(NewPagerDutyEvent(check, "trigger"))
+	if _, _, err := SendWebHook(&WebHook{Kind: "pagerduty", URL: ts.URL, Payload: payload}); err == nil {
+		t.Errorf("rate limited event should fail")
+	}
+}
+
+func TestStalePagerDutyEvents(t *testing.T) {
+	check := NewCheck()
+	check.ID = "pd"
+	check.PagerDuty = "R0UT1NGK3Y"
+	other := NewCheck()
+	other.ID = "other"
+	other.PagerDuty = "R0UT1NGK3Y"
+	trigger, _ := json.Marshal(NewPagerDutyEvent(check, "trigger"))
+	otherTrigger, _ := json.Marshal(NewPagerDutyEvent(other, "trigger"))
+	pending := []*WebHook{
+		&WebHook{ID: "queued", Kind: "pagerduty", CheckID: check.ID, Payload: trigger},
+		&WebHook{ID: "other", Kind: "pagerduty", CheckID: other.ID, Payload: otherTrigger},
+		&WebHook{ID: "slack", Kind: "slack", CheckID: check.ID, Payload: []byte(`{}`)},
+	}
+	stale := stalePagerDutyEvents(pending, check)
+	if len(stale) != 1 || stale[0].ID != "queued" {
+		t.Errorf("expected the queued trigger to be stale, got %v", stale)
+	}
+}
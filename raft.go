@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/bitly/go-nsq"
@@ -239,8 +240,12 @@ func (r *Raft) Close() {
 }
 
 func (r *Raft) ExecCommand(msg []byte) error {
+	start := time.Now()
 	future := r.raft.Apply(msg, 30*time.Second)
-	return future.Error()
+	err := future.Error()
+	atomic.AddUint64(&raftApplies, 1)
+	atomic.AddUint64(&raftApplyNanos, uint64(time.Since(start)))
+	return err
 }
 
 // Sync the FSM
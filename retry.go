@@ -0,0 +1,118 @@
+package neverdown
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures the retries of failed notifications, delays are in
+// seconds. Fields are pointers so an explicit 0 (no jitter, no max delay or
+// max age) can be told apart from an unset field.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of delivery attempts (including the first one)
+	MaxAttempts *int `json:"max_attempts,omitempty"`
+	// The delay before the Nth retry is BaseDelay * 2^(N-1), capped to MaxDelay
+	// (0 to disable, the delay is still capped to MaxRetryDelay)
+	BaseDelay *int `json:"base_delay,omitempty"`
+	MaxDelay  *int `json:"max_delay,omitempty"`
+	// Jitter randomizes the delay by +/- the given fraction (0 to 1)
+	Jitter *float64 `json:"jitter,omitempty"`
+	// MaxAge is the number of seconds after the first try the delivery is abandoned (0 to disable)
+	MaxAge *int `json:"max_age,omitempty"`
+}
+
+// MaxRetryDelay is the maximum delay (in seconds) between two retries, even
+// if the policy MaxDelay is 0 (the exponential delay would overflow).
+var MaxRetryDelay = 30 * 24 * 3600
+
+func intPtr(v int) *int { return &v }
+
+func floatPtr(v float64) *float64 { return &v }
+
+// DefaultRetryPolicy is used for the webhooks without a retry policy, and
+// for the unset fields of the webhook targets retry policy.
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts: intPtr(20),
+	BaseDelay:   intPtr(1),
+	MaxDelay:    intPtr(3600),
+	Jitter:      floatPtr(0.1),
+	MaxAge:      intPtr(86400),
+}
+
+// Validate checks the retry policy configuration.
+func (p *RetryPolicy) Validate() error {
+	for _, v := range []*int{p.BaseDelay, p.MaxDelay, p.MaxAge} {
+		if v != nil && *v < 0 {
+			return fmt.Errorf("retry policy values must be positive")
+		}
+	}
+	if p.MaxAttempts != nil && *p.MaxAttempts < 1 {
+		return fmt.Errorf("retry max_attempts must be at least 1")
+	}
+	if p.MaxDelay != nil && p.BaseDelay != nil && *p.MaxDelay != 0 && *p.MaxDelay < *p.BaseDelay {
+		return fmt.Errorf("retry max_delay must be greater than base_delay")
+	}
+	if p.Jitter != nil && (*p.Jitter < 0 || *p.Jitter > 1) {
+		return fmt.Errorf("retry jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// WithDefaults returns a copy of the policy, unset fields are set to the DefaultRetryPolicy values.
+func (p *RetryPolicy) WithDefaults() *RetryPolicy {
+	policy := *DefaultRetryPolicy
+	if p == nil {
+		return &policy
+	}
+	if p.MaxAttempts != nil {
+		policy.MaxAttempts = p.MaxAttempts
+	}
+	if p.BaseDelay != nil {
+		policy.BaseDelay = p.BaseDelay
+	}
+	if p.MaxDelay != nil {
+		policy.MaxDelay = p.MaxDelay
+	}
+	if p.Jitter != nil {
+		policy.Jitter = p.Jitter
+	}
+	if p.MaxAge != nil {
+		policy.MaxAge = p.MaxAge
+	}
+	return &policy
+}
+
+// Delay returns the delay before the next attempt, given the number of failed
+// tries (the policy must have every field set, see WithDefaults).
+func (p *RetryPolicy) Delay(tries int) time.Duration {
+	if tries < 1 {
+		tries = 1
+	}
+	delay := float64(*p.BaseDelay) * math.Pow(2, float64(tries-1))
+	if *p.MaxDelay > 0 && delay > float64(*p.MaxDelay) {
+		delay = float64(*p.MaxDelay)
+	}
+	if delay > float64(MaxRetryDelay) {
+		delay = float64(MaxRetryDelay)
+	}
+	if *p.Jitter > 0 {
+		delay = delay * (1 + *p.Jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(delay * float64(time.Second))
+}
+
+// Exhausted returns true if the WebHook shouldn't be retried anymore (the
+// policy must have every field set, see WithDefaults).
+func (p *RetryPolicy) Exhausted(wh *WebHook, now time.Time) bool {
+	if wh.Tries >= *p.MaxAttempts {
+		return true
+	}
+	return *p.MaxAge > 0 && now.Sub(time.Unix(wh.FirstTry, 0)) >= time.Duration(*p.MaxAge)*time.Second
+}
+
+// Policy returns the retry policy of the WebHook.
+func (wh *WebHook) Policy() *RetryPolicy {
+	return wh.Retry.WithDefaults()
+}
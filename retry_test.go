@@ -0,0 +1,114 @@
+package neverdown
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := (&RetryPolicy{BaseDelay: intPtr(2), MaxDelay: intPtr(60), Jitter: floatPtr(0)}).WithDefaults()
+	for _, tc := range []struct {
+		tries    int
+		expected time.Duration
+	}{
+		{0, 2 * time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{5, 32 * time.Second},
+		{6, 60 * time.Second},
+		{20, 60 * time.Second},
+	} {
+		if delay := policy.Delay(tc.tries); delay != tc.expected {
+			t.Errorf("tries=%d: got delay %v, expected %v", tc.tries, delay, tc.expected)
+		}
+	}
+
+	// No cap
+	policy.MaxDelay = intPtr(0)
+	if delay := policy.Delay(10); delay != 1024*time.Second {
+		t.Errorf("got uncapped delay %v, expected 1024s", delay)
+	}
+
+	// The uncapped delay is still limited to MaxRetryDelay instead of overflowing
+	for _, tries := range []int{35, 64, 2000} {
+		if delay := policy.Delay(tries); delay != time.Duration(MaxRetryDelay)*time.Second {
+			t.Errorf("tries=%d: got uncapped delay %v, expected %v", tries, delay, time.Duration(MaxRetryDelay)*time.Second)
+		}
+	}
+
+	// The jitter randomizes the delay by +/- 10%
+	policy.Jitter = floatPtr(0.1)
+	for i := 0; i < 100; i++ {
+		if delay := policy.Delay(3); delay < 7200*time.Millisecond || delay > 8800*time.Millisecond {
+			t.Fatalf("delay %v out of the jitter bounds", delay)
+		}
+	}
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, tc := range []struct {
+		policy    *RetryPolicy
+		tries     int
+		age       time.Duration
+		exhausted bool
+	}{
+		{&RetryPolicy{MaxAttempts: intPtr(3)}, 2, time.Minute, false},
+		{&RetryPolicy{MaxAttempts: intPtr(3)}, 3, time.Minute, true},
+		{&RetryPolicy{MaxAge: intPtr(3600)}, 2, 59 * time.Minute, false},
+		{&RetryPolicy{MaxAge: intPtr(3600)}, 2, time.Hour, true},
+		// The default max age is 1 day
+		{nil, 2, 25 * time.Hour, true},
+		// An explicit 0 disables the age limit
+		{&RetryPolicy{MaxAge: intPtr(0)}, 2, 30 * 24 * time.Hour, false},
+	} {
+		wh := &WebHook{Tries: tc.tries, FirstTry: now.Add(-tc.age).Unix()}
+		if exhausted := tc.policy.WithDefaults().Exhausted(wh, now); exhausted != tc.exhausted {
+			t.Errorf("%+v tries=%d age=%v: got exhausted=%v", tc.policy, tc.tries, tc.age, exhausted)
+		}
+	}
+}
+
+func TestRetryPolicyExplicitZero(t *testing.T) {
+	policy := &RetryPolicy{}
+	if err := json.Unmarshal([]byte(`{"jitter": 0, "max_age": 0}`), policy); err != nil {
+		t.Fatalf("failed to decode the policy: %v", err)
+	}
+	policy = policy.WithDefaults()
+	if *policy.Jitter != 0 || *policy.MaxAge != 0 {
+		t.Errorf("explicit zero values should be kept, got jitter=%v max_age=%v", *policy.Jitter, *policy.MaxAge)
+	}
+	if *policy.MaxAttempts != 20 || *policy.BaseDelay != 1 || *policy.MaxDelay != 3600 {
+		t.Errorf("unset fields should use the default policy")
+	}
+
+	// The explicit zero survives the FSM serialization of the webhook
+	wh := &WebHook{ID: "zero", Retry: &RetryPolicy{Jitter: floatPtr(0)}}
+	restored := &WebHook{}
+	if err := json.Unmarshal(wh.ToPostCmd()[1:], restored); err != nil {
+		t.Fatalf("failed to decode the webhook: %v", err)
+	}
+	if restored.Retry == nil || restored.Retry.Jitter == nil || *restored.Retry.Jitter != 0 {
+		t.Errorf("explicit zero jitter was lost: %+v", restored.Retry)
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	for _, tc := range []struct {
+		policy *RetryPolicy
+		valid  bool
+	}{
+		{&RetryPolicy{}, true},
+		{&RetryPolicy{Jitter: floatPtr(0), MaxAge: intPtr(0), MaxDelay: intPtr(0)}, true},
+		{&RetryPolicy{MaxAttempts: intPtr(0)}, false},
+		{&RetryPolicy{BaseDelay: intPtr(-1)}, false},
+		{&RetryPolicy{BaseDelay: intPtr(10), MaxDelay: intPtr(5)}, false},
+		{&RetryPolicy{Jitter: floatPtr(1.5)}, false},
+	} {
+		if err := tc.policy.Validate(); tc.valid != (err == nil) {
+			t.Errorf("%+v: unexpected error %v", tc.policy, err)
+		}
+	}
+}
@@ -16,6 +16,7 @@ type Scheduler struct {
 	Reloadch     chan struct{}
 	running      bool
 	checks       []*Check
+	history      *HistoryBuffer
 }
 
 // NewScheduler initializes a new empty Scheduler.
@@ -25,6 +26,7 @@ func NewScheduler(raft *Raft, webhookSched *WebHookScheduler) *Scheduler {
 		webhookSched: webhookSched,
 		stop:         make(chan struct{}),
 		Reloadch:     make(chan struct{}),
+		history:      &HistoryBuffer{},
 	}
 }
 
@@ -36,19 +38,119 @@ func (d *Scheduler) Stop() {
 }
 
 // Reload will recompute the next execution time of every checks.
-func (d *Scheduler) Reload() {
-	d.webhookSched.Reload()
+func (d *Scheduler) Reload() error {
+	if err := d.webhookSched.Reload(); err != nil {
+		return err
+	}
 	d.Reloadch <- struct{}{}
+	return nil
 }
 
 func (d *Scheduler) updateChecks() error {
-	d.checks = []*Check{}
-	for _, check := range d.raft.Store.ChecksIndex {
-		d.checks = append(d.checks, check)
-	}
+	d.checks = d.raft.Store.Checks()
 	return nil
 }
 
+// notify publishes the check on NSQ, and executes emails/webhooks/Slack notifications,
+// returns the sent notifications.
+func (d *Scheduler) notify(check *Check, incident *Incident) []*Notification {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	notifications := []*Notification{}
+	record := func(channel string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		n := &Notification{
+			Time:    time.Now().UTC().Unix(),
+			Event:   check.Event,
+			Channel: channel,
+		}
+		if err != nil {
+			log.Printf("Failed to send %v notification for check %v: %v", channel, check.ID, err)
+			n.Error = err.Error()
+		}
+		notifications = append(notifications, n)
+	}
+	wg.Add(4)
+	go func(check *Check) {
+		defer wg.Done()
+		if d.raft.Producer == nil {
+			return
+		}
+		js, err := json.Marshal(check)
+		if err != nil {
+			panic(err)
+		}
+		record("nsq", d.raft.Producer.Publish("neverdown", js))
+	}(check)
+	go func(check *Check) {
+		defer wg.Done()
+		if len(check.Emails) == 0 {
+			return
+		}
+		record("email", NotifyEmails(d.raft, d.webhookSched, check))
+	}(check)
+	go func(check *Check) {
+		defer wg.Done()
+		if len(check.WebHooks) == 0 && len(check.WebHookTargets) == 0 {
+			return
+		}
+		record("webhook", ExecuteWebhooks(d.raft, d.webhookSched, check, incident))
+	}(check)
+	go func(check *Check) {
+		defer wg.Done()
+		if len(check.Slack) == 0 {
+			return
+		}
+		record("slack", NotifySlack(d.raft, d.webhookSched, check, incident))
+	}(check)
+	wg.Wait()
+	return notifications
+}
+
+// notifyPagerDuty sends the check status change to PagerDuty, it's called on
+// every status change (even while the check is flapping) so every "trigger"
+// has a matching "resolve".
+func (d *Scheduler) notifyPagerDuty(check *Check) []*Notification {
+	action := PagerDutyAction(check)
+	if check.PagerDuty == "" || action == "" {
+		return nil
+	}
+	n := &Notification{
+		Time:    time.Now().UTC().Unix(),
+		Event:   check.Event,
+		Channel: "pagerduty",
+	}
+	if err := NotifyPagerDuty(d.raft, d.webhookSched, check, action); err != nil {
+		log.Printf("Failed to send pagerduty notification for check %v: %v", check.ID, err)
+		n.Error = err.Error()
+	}
+	return []*Notification{n}
+}
+
+// trackIncident opens an incident when the check goes down, and resolves it
+// when it goes back up, returns (a copy of) the current incident (nil if there
+// is no incident), and whether it changed.
+func (d *Scheduler) trackIncident(check *Check, oldStatus string, prs []*PingResponse) (*Incident, bool) {
+	now := time.Now().UTC().Unix()
+	var incident *Incident
+	if check.IncidentID != "" {
+		if stored := d.raft.Store.Incident(check.IncidentID); stored != nil && stored.End == 0 {
+			incident = stored
+		}
+	}
+	switch {
+	case check.Status == StatusDown && oldStatus != StatusDown:
+		incident = NewIncident(check, prs, now)
+		check.IncidentID = incident.ID
+		return incident, true
+	case check.Status != StatusDown && oldStatus == StatusDown && incident != nil:
+		incident.Resolve(check, now)
+		return incident, true
+	}
+	return incident, false
+}
+
 // Run starts the processing of jobs, and listens for config update.
 func (d *Scheduler) Run() {
 	go d.webhookSched.Run()
@@ -58,6 +160,8 @@ func (d *Scheduler) Run() {
 	}
 	now := time.Now().UTC()
 	d.running = true
+	flushTicker := time.NewTicker(HistoryFlushInterval)
+	defer flushTicker.Stop()
 	var checkTime time.Time
 	for {
 		sort.Sort(byTime(d.checks))
@@ -80,48 +184,64 @@ func (d *Scheduler) Run() {
 					check.Prev = check.Next
 				}
 				go func(check *Check) {
-					oldStatus := check.Up
-					LeaderCheck(d.raft, check)
+					oldStatus := check.Status
+					oldCertExpiring := check.CertExpiring
+					// Heartbeats are stored in the FSM
+					if stored := d.raft.Store.Check(check.ID); stored != nil {
+						check.mergeHeartbeats(stored)
+					}
+					prs, err := LeaderCheck(d.raft, check)
+					if err != nil {
+						log.Printf("Failed to perform check %v: %v", check.ID, err)
+					} else if d.history.Add(NewResult(check, prs[0], time.Now().UTC().Unix())) {
+						d.history.Flush(d.raft)
+					}
 					if !check.Next.IsZero() {
 						check.LastCheck = check.Next.Unix()
 					}
-					// Re-compute the uptime percentage
-					if check.TimeDown > 0 {
-						total := check.Interval * check.Pings
-						check.Uptime = float32(int64(total)-check.TimeDown) / float32(total)
-						log.Printf("uptime:%+v", check)
+					incident, incidentChanged := d.trackIncident(check, oldStatus, prs)
+					notifications := []*Notification{}
+					check.RecordStatus()
+					if check.DetectFlapping() {
+						log.Printf("Check %v flapping changed to %v (ratio:%.2f)", check.ID, check.Flapping, check.FlapRatio())
+						if check.Status != oldStatus {
+							check.PrevStatus = oldStatus
+						}
+						check.Event = EventFlappingStop
+						if check.Flapping {
+							check.Event = EventFlappingStart
+						}
+						notifications = append(notifications, d.notify(check, incident)...)
+					} else if check.Status != oldStatus {
+						log.Printf("Check %v status changed from %v to %v", check.ID, oldStatus, check.Status)
+						check.PrevStatus = oldStatus
+						// Individual transitions are not notified while the check is flapping
+						if !check.Flapping {
+							check.Event = EventStatus
+							notifications = append(notifications, d.notify(check, incident)...)
+						}
+					}
+					if check.Status != oldStatus {
+						notifications = append(notifications, d.notifyPagerDuty(check)...)
+					}
+					check.CertExpiring = check.CertExpiresSoon(time.Now().UTC())
+					if check.CertExpiring && !oldCertExpiring {
+						log.Printf("Check %v certificate expires on %v", check.ID, check.Cert.Expires())
+						check.Event = EventCertExpiring
+						notifications = append(notifications, d.notify(check, incident)...)
+					}
+					if incident != nil && len(notifications) > 0 {
+						incident.AddNotifications(notifications)
+						incidentChanged = true
 					}
-					if check.Up != oldStatus {
-						log.Printf("Check %v status changed from %v to %v", check.ID, oldStatus, check.Up)
-						var wg sync.WaitGroup
-						wg.Add(3)
-						go func(check *Check) {
-							defer wg.Done()
-							if d.raft.Producer == nil {
-								return
-							}
-							js, err := json.Marshal(check)
-							if err != nil {
-								panic(err)
-							}
-							if err := d.raft.Producer.Publish("neverdown", js); err != nil {
-								panic(err)
-							}
-						}(check)
-						go func(check *Check) {
-							defer wg.Done()
-							if err := NotifyEmails(check); err != nil {
-								panic(err)
-							}
-						}(check)
-						go func(check *Check) {
-							defer wg.Done()
-							if err := ExecuteWebhooks(d.raft, d.webhookSched, check); err != nil {
-								panic(err)
-							}
-						}(check)
-						wg.Wait()
+					// The incident is only replicated when it changes
+					if incidentChanged {
+						if err := d.raft.ExecCommand(incident.ToPostCmd()); err != nil {
+							panic(err)
+						}
 					}
+					// Re-compute the uptime percentages from the incidents
+					d.raft.Store.UpdateUptimes(check, time.Now().UTC())
 					if err := d.raft.ExecCommand(check.ToPostCmd()); err != nil {
 						panic(err)
 					}
@@ -129,7 +249,11 @@ func (d *Scheduler) Run() {
 				check.ComputeNext(now)
 				continue
 			}
+		case now = <-flushTicker.C:
+			now = now.UTC()
+			go d.history.Flush(d.raft)
 		case <-d.stop:
+			d.history.Flush(d.raft)
 			d.running = false
 			return
 		case <-d.Reloadch:
@@ -0,0 +1,135 @@
+package neverdown
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UptimeWindows are the rolling windows of the check Uptimes.
+var UptimeWindows = []string{"24h", "7d", "30d", "90d"}
+
+// SLA is the availability report of a check over a period.
+type SLA struct {
+	CheckID string `json:"check_id"`
+	Period  string `json:"period"`
+	From    int64  `json:"from"`
+	To      int64  `json:"to"`
+	// Monitored is the number of seconds the check was monitored during the period
+	Monitored int64   `json:"monitored"`
+	Uptime    float64 `json:"uptime"`
+	Downtime  int64   `json:"downtime"`
+	Incidents int     `json:"incidents"`
+	// MTTR (mean time to recovery) and MTBF (mean time between failures) are in seconds
+	MTTR float64 `json:"mttr"`
+	MTBF float64 `json:"mtbf"`
+}
+
+// ParsePeriod returns the bounds of a period, either a rolling window ending now
+// ("24h", "7d"...) or a calendar month ("2026-09").
+func ParsePeriod(period string, now time.Time) (time.Time, time.Time, error) {
+	if month, err := time.Parse("2006-01", period); err == nil {
+		return month, month.AddDate(0, 1, 0), nil
+	}
+	if strings.HasSuffix(period, "d") {
+		var days int
+		if _, err := fmt.Sscanf(period, "%dd", &days); err == nil && days > 0 {
+			return now.AddDate(0, 0, -days), now, nil
+		}
+	}
+	if d, err := time.ParseDuration(period); err == nil && d > 0 {
+		return now.Add(-d), now, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid period %q", period)
+}
+
+// ComputeSLA computes the SLA of the check between from and to, using the
+// check incidents (down periods).
+func ComputeSLA(check *Check, incidents []*Incident, from, to, now time.Time) *SLA {
+	sla := &SLA{
+		CheckID: check.ID,
+		From:    from.Unix(),
+		To:      to.Unix(),
+		Uptime:  100.0,
+	}
+	start, end := from.Unix(), to.Unix()
+	if check.FirstCheck > start {
+		start = check.FirstCheck
+	}
+	if end > now.Unix() {
+		end = now.Unix()
+	}
+	if check.FirstCheck == 0 || end <= start {
+		return sla
+	}
+	sla.Monitored = end - start
+	var resolved, repairTime int64
+	for _, incident := range incidents {
+		incidentEnd := incident.End
+		if incidentEnd == 0 {
+			incidentEnd = now.Unix()
+		}
+		if incidentEnd <= start || incident.Start >= end {
+			continue
+		}
+		sla.Incidents++
+		if incident.End != 0 {
+			resolved++
+			repairTime += incident.Duration
+		}
+		overlapStart, overlapEnd := incident.Start, incidentEnd
+		if overlapStart < start {
+			overlapStart = start
+		}
+		if overlapEnd > end {
+			overlapEnd = end
+		}
+		sla.Downtime += overlapEnd - overlapStart
+	}
+	sla.Uptime = 100.0 * float64(sla.Monitored-sla.Downtime) / float64(sla.Monitored)
+	if resolved > 0 {
+		sla.MTTR = float64(repairTime) / float64(resolved)
+	}
+	if sla.Incidents > 0 {
+		sla.MTBF = float64(sla.Monitored-sla.Downtime) / float64(sla.Incidents)
+	}
+	return sla
+}
+
+// SLA computes the SLA of the check for the given period.
+func (s *Store) SLA(check *Check, period string, now time.Time) (*SLA, error) {
+	from, to, err := ParsePeriod(period, now)
+	if err != nil {
+		return nil, err
+	}
+	sla := ComputeSLA(check, s.Incidents(check.ID), from, to, now)
+	sla.Period = period
+	return sla, nil
+}
+
+// AllTimeUptime returns the all-time uptime percentage of the check, computed
+// from the downtime accumulated on the check (TimeDown) since the incidents
+// older than MaxIncidentAge are pruned.
+func AllTimeUptime(check *Check, now time.Time) float64 {
+	monitored := now.Unix() - check.FirstCheck
+	if check.FirstCheck == 0 || monitored <= 0 {
+		return 100.0
+	}
+	downtime := check.TimeDown
+	if downtime > monitored {
+		downtime = monitored
+	}
+	return 100.0 * float64(monitored-downtime) / float64(monitored)
+}
+
+// UpdateUptimes re-computes the all-time uptime percentage of the check,
+// and the uptime over the rolling windows (from the incidents).
+func (s *Store) UpdateUptimes(check *Check, now time.Time) {
+	incidents := s.Incidents(check.ID)
+	check.Uptime = float32(AllTimeUptime(check, now))
+	check.Uptimes = map[string]float64{}
+	for _, window := range UptimeWindows {
+		from, to, _ := ParsePeriod(window, now)
+		check.Uptimes[window] = ComputeSLA(check, incidents, from, to, now).Uptime
+	}
+}
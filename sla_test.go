@@ -0,0 +1,141 @@
+package neverdown
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		period   string
+		from, to time.Time
+		valid    bool
+	}{
+		{"2026-09", time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), true},
+		// December ends on the next year
+		{"2026-12", time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		// Leap year
+		{"2024-02", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"30d", now.AddDate(0, 0, -30), now, true},
+		{"7d", now.AddDate(0, 0, -7), now, true},
+		{"24h", now.Add(-24 * time.Hour), now, true},
+		{"90m", now.Add(-90 * time.Minute), now, true},
+		{"0d", time.Time{}, time.Time{}, false},
+		{"-1d", time.Time{}, time.Time{}, false},
+		{"-1h", time.Time{}, time.Time{}, false},
+		{"2026-13", time.Time{}, time.Time{}, false},
+		{"month", time.Time{}, time.Time{}, false},
+		{"", time.Time{}, time.Time{}, false},
+	} {
+		from, to, err := ParsePeriod(tc.period, now)
+		if !tc.valid {
+			if err == nil {
+				t.Errorf("%q should be invalid", tc.period)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.period, err)
+			continue
+		}
+		if !from.Equal(tc.from) || !to.Equal(tc.to) {
+			t.Errorf("%q: got %v-%v, expected %v-%v", tc.period, from, to, tc.from, tc.to)
+		}
+	}
+}
+
+func TestComputeSLA(t *testing.T) {
+	date := func(month time.Month, day, hour, min int) int64 {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC).Unix()
+	}
+	resolved := func(start, end int64) *Incident {
+		return &Incident{Start: start, End: end, Duration: end - start}
+	}
+	incidents := []*Incident{
+		// Ends when the period starts
+		resolved(date(8, 31, 22, 0), date(9, 1, 0, 0)),
+		// Overlaps the period start (1h in the period)
+		resolved(date(8, 31, 23, 0), date(9, 1, 1, 0)),
+		resolved(date(9, 15, 10, 0), date(9, 15, 10, 30)),
+		// Overlaps the period end (30m in the period)
+		resolved(date(9, 30, 23, 30), date(10, 1, 0, 30)),
+		// After the period
+		resolved(date(10, 2, 0, 0), date(10, 2, 1, 0)),
+	}
+	check := NewCheck()
+	check.ID = "sla"
+	check.FirstCheck = date(8, 1, 0, 0)
+	from, to, _ := ParsePeriod("2026-09", time.Time{})
+	now := time.Unix(date(10, 18, 12, 0), 0)
+
+	sla := ComputeSLA(check, incidents, from, to, now)
+	month := int64(30 * 86400)
+	if sla.Monitored != month || sla.Downtime != 7200 || sla.Incidents != 3 {
+		t.Fatalf("unexpected SLA %+v", sla)
+	}
+	if expected := 100 * float64(month-7200) / float64(month); math.Abs(sla.Uptime-expected) > 1e-9 {
+		t.Errorf("got uptime %v, expected %v", sla.Uptime, expected)
+	}
+	// The full incidents durations are used for the MTTR
+	if sla.MTTR != float64(7200+1800+3600)/3 {
+		t.Errorf("got MTTR %v", sla.MTTR)
+	}
+	if sla.MTBF != float64(month-7200)/3 {
+		t.Errorf("got MTBF %v", sla.MTBF)
+	}
+
+	// The check was created during the period, and the period isn't over
+	check.FirstCheck = date(9, 15, 0, 0)
+	now = time.Unix(date(9, 16, 0, 0), 0)
+	ongoing := &Incident{Start: date(9, 15, 23, 0)}
+	sla = ComputeSLA(check, []*Incident{incidents[2], ongoing}, from, to, now)
+	if sla.Monitored != 86400 || sla.Downtime != 1800+3600 || sla.Incidents != 2 {
+		t.Fatalf("unexpected SLA %+v", sla)
+	}
+	// Ongoing incidents are not used for the MTTR
+	if sla.MTTR != 1800 {
+		t.Errorf("got MTTR %v, expected 1800", sla.MTTR)
+	}
+
+	// Not monitored during the period
+	check.FirstCheck = date(10, 5, 0, 0)
+	sla = ComputeSLA(check, incidents, from, to, now)
+	if sla.Monitored != 0 || sla.Uptime != 100 || sla.Incidents != 0 {
+		t.Errorf("unexpected SLA %+v", sla)
+	}
+	check.FirstCheck = 0
+	sla = ComputeSLA(check, incidents, from, to, now)
+	if sla.Monitored != 0 || sla.Uptime != 100 {
+		t.Errorf("unexpected SLA %+v", sla)
+	}
+}
+
+func TestUpdateUptimes(t *testing.T) {
+	now := time.Date(2026, 9, 15, 0, 0, 0, 0, time.UTC)
+	s := NewStore()
+	check := NewCheck()
+	check.ID = "uptime"
+	check.FirstCheck = now.AddDate(-2, 0, 0).Unix()
+	// 1 day of downtime, including an outage older than MaxIncidentAge (pruned)
+	check.TimeDown = 86400
+	s.AddIncident(&Incident{ID: "recent", CheckID: check.ID, Start: now.Add(-12 * time.Hour).Unix(), End: now.Add(-6 * time.Hour).Unix(), Duration: 6 * 3600})
+	s.UpdateUptimes(check, now)
+	monitored := float64(now.Unix() - check.FirstCheck)
+	if expected := float32(100.0 * (monitored - 86400) / monitored); check.Uptime != expected {
+		t.Errorf("got all-time uptime %v, expected %v", check.Uptime, expected)
+	}
+	if check.Uptimes["24h"] != 75.0 {
+		t.Errorf("got 24h uptime %v, expected 75", check.Uptimes["24h"])
+	}
+
+	// The downtime can't exceed the monitored time
+	check.FirstCheck = now.Add(-time.Hour).Unix()
+	if uptime := AllTimeUptime(check, now); uptime != 0 {
+		t.Errorf("got all-time uptime %v, expected 0", uptime)
+	}
+	if uptime := AllTimeUptime(NewCheck(), now); uptime != 100 {
+		t.Errorf("got all-time uptime %v for an unchecked check, expected 100", uptime)
+	}
+}
@@ -0,0 +1,120 @@
+package neverdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SlackField is a field of a Slack message attachment.
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// SlackAttachment is a colored Slack message attachment.
+type SlackAttachment struct {
+	Fallback  string        `json:"fallback"`
+	Color     string        `json:"color"`
+	Title     string        `json:"title"`
+	TitleLink string        `json:"title_link,omitempty"`
+	Text      string        `json:"text,omitempty"`
+	Fields    []*SlackField `json:"fields"`
+	Ts        int64         `json:"ts"`
+}
+
+// SlackMessage is the payload of a Slack incoming webhook.
+type SlackMessage struct {
+	Attachments []*SlackAttachment `json:"attachments"`
+}
+
+// NewSlackMessage formats the check event, the incident (if any) is used to
+// display the outage duration and the confirming nodes.
+func NewSlackMessage(check *Check, incident *Incident) *SlackMessage {
+	now := time.Now().UTC().Unix()
+	att := &SlackAttachment{
+		Fields: []*SlackField{},
+		Ts:     now,
+	}
+	if strings.HasPrefix(check.URL, "http") {
+		att.TitleLink = check.URL
+	}
+	switch check.Event {
+	case EventCertExpiring:
+		att.Color = "warning"
+		att.Title = fmt.Sprintf("%v certificate expires soon", check.DisplayName())
+		if check.Cert != nil {
+			att.Text = fmt.Sprintf("The certificate issued by %v expires on %v", check.Cert.Issuer, check.Cert.Expires())
+		}
+	case EventFlappingStart:
+		att.Color = "warning"
+		att.Title = fmt.Sprintf("%v is flapping", check.DisplayName())
+		att.Text = "Notifications are suspended until the check stabilizes."
+	default:
+		att.Title = fmt.Sprintf("%v is %v", check.DisplayName(), check.Status)
+		switch check.Status {
+		case StatusUp:
+			att.Color = "good"
+		case StatusDegraded:
+			att.Color = "warning"
+		default:
+			att.Color = "danger"
+		}
+	}
+	att.Fallback = att.Title
+	if check.URL != "" {
+		att.Fields = append(att.Fields, &SlackField{Title: "URL", Value: check.URL})
+	}
+	if check.PrevStatus != "" && check.Event == EventStatus {
+		att.Fields = append(att.Fields, &SlackField{Title: "Previous status", Value: check.PrevStatus, Short: true})
+	}
+	if incident != nil {
+		if incident.Error != nil {
+			att.Fields = append(att.Fields, &SlackField{
+				Title: "Error",
+				Value: fmt.Sprintf("%v: %v", incident.Error.Type, incident.Error.Error),
+				Short: true,
+			})
+		}
+		duration := incident.Duration
+		if incident.End == 0 {
+			duration = now - incident.Start
+		}
+		att.Fields = append(att.Fields, &SlackField{
+			Title: "Down for",
+			Value: (time.Duration(duration) * time.Second).String(),
+			Short: true,
+		})
+		nodes := []string{}
+		for _, pr := range incident.Responses {
+			nodes = append(nodes, pr.Node)
+		}
+		if len(nodes) > 0 {
+			att.Fields = append(att.Fields, &SlackField{Title: "Confirmed by", Value: strings.Join(nodes, ", ")})
+		}
+	}
+	return &SlackMessage{Attachments: []*SlackAttachment{att}}
+}
+
+// NotifySlack posts the check event to the check Slack incoming webhooks,
+// failed deliveries are retried by the WebHookScheduler.
+func NotifySlack(ra *Raft, whSched *WebHookScheduler, check *Check, incident *Incident) error {
+	log.Printf("NotifySlack %v", check.ID)
+	payload, err := json.Marshal(NewSlackMessage(check, incident))
+	if err != nil {
+		return err
+	}
+	for _, url := range check.Slack {
+		wh := &WebHook{Kind: "slack", CheckID: check.ID, URL: url, Payload: payload, Retry: check.SlackRetry}
+		if err := DeliverWebHook(ra, wh); err != nil {
+			log.Printf("Failed to notify Slack for check %v: %v", check.ID, err)
+			if err := QueueWebHook(ra, whSched, wh); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package neverdown
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewSlackMessage(t *testing.T) {
+	check := NewCheck()
+	check.ID = "slack"
+	check.Name = "Website"
+	check.URL = "http://example.com"
+	check.Event = EventStatus
+	check.PrevStatus = StatusUp
+	check.Status = StatusDown
+	incident := &Incident{
+		Start:     time.Now().UTC().Unix() - 90,
+		Error:     &PingError{Type: "server", Error: "connection refused"},
+		Responses: []*PingResponse{&PingResponse{Node: "node1"}, &PingResponse{Node: "node2"}},
+	}
+	att := NewSlackMessage(check, incident).Attachments[0]
+	if att.Title != "Website is down" || att.Fallback != att.Title || att.Color != "danger" || att.TitleLink != check.URL {
+		t.Errorf("unexpected attachment %+v", att)
+	}
+	fields := map[string]string{}
+	for _, f := range att.Fields {
+		fields[f.Title] = f.Value
+	}
+	for title, value := range map[string]string{
+		"URL":             "http://example.com",
+		"Previous status": StatusUp,
+		"Error":           "server: connection refused",
+		"Confirmed by":    "node1, node2",
+	} {
+		if fields[title] != value {
+			t.Errorf("field %q: got %q, expected %q", title, fields[title], value)
+		}
+	}
+	if d, err := time.ParseDuration(fields["Down for"]); err != nil || d < 90*time.Second || d > 95*time.Second {
+		t.Errorf("unexpected outage duration %q", fields["Down for"])
+	}
+
+	// Recovery
+	check.PrevStatus = StatusDown
+	check.Status = StatusUp
+	incident.End = incident.Start + 300
+	incident.Duration = 300
+	att = NewSlackMessage(check, incident).Attachments[0]
+	if att.Title != "Website is up" || att.Color != "good" {
+		t.Errorf("unexpected attachment %+v", att)
+	}
+	for _, f := range att.Fields {
+		if f.Title == "Down for" && f.Value != "5m0s" {
+			t.Errorf("got outage duration %q, expected 5m0s", f.Value)
+		}
+	}
+
+	for _, tc := range []struct {
+		event, status, title, color string
+	}{
+		{EventStatus, StatusDegraded, "Website is degraded", "warning"},
+		{EventCertExpiring, StatusUp, "Website certificate expires soon", "warning"},
+		{EventFlappingStart, StatusDown, "Website is flapping", "warning"},
+	} {
+		check.Event = tc.event
+		check.Status = tc.status
+		check.Cert = &CertInfo{Issuer: "Test CA", NotAfter: 1700000000}
+		att := NewSlackMessage(check, nil).Attachments[0]
+		if att.Title != tc.title || att.Color != tc.color {
+			t.Errorf("%v/%v: got %q (%v), expected %q (%v)", tc.event, tc.status, att.Title, att.Color, tc.title, tc.color)
+		}
+	}
+}
+
+func TestSlackWebHook(t *testing.T) {
+	var received *SlackMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = &SlackMessage{}
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(body, received) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid_payload"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	check := NewCheck()
+	check.ID = "slack"
+	check.URL = "http://example.com"
+	check.Status = StatusDown
+	payload, err := json.Marshal(NewSlackMessage(check, nil))
+	if err != nil {
+		t.Fatalf("failed to marshal the message: %v", err)
+	}
+	d, err := attemptWebHook(&WebHook{Kind: "slack", URL: ts.URL, Payload: payload})
+	if err != nil || !d.Success || d.Response != "ok" {
+		t.Fatalf("delivery failed: %v %+v", err, d)
+	}
+	if len(received.Attachments) != 1 || received.Attachments[0].Title != "slack is down" {
+		t.Errorf("unexpected message %+v", received)
+	}
+}
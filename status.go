@@ -0,0 +1,64 @@
+package neverdown
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseStatusRange parses an expected status code specification,
+// either a single code ("204"), a class ("2xx") or a range ("200-399").
+func parseStatusRange(spec string) (int, int, error) {
+	spec = strings.TrimSpace(spec)
+	if len(spec) == 3 && strings.HasSuffix(strings.ToLower(spec), "xx") {
+		class, err := strconv.Atoi(spec[:1])
+		if err != nil || class < 1 || class > 5 {
+			return 0, 0, fmt.Errorf("invalid status class %q", spec)
+		}
+		return class * 100, class*100 + 99, nil
+	}
+	bounds := strings.SplitN(spec, "-", 2)
+	min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid status code %q", spec)
+	}
+	max := min
+	if len(bounds) == 2 {
+		max, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid status code %q", spec)
+		}
+	}
+	if min < 100 || max > 599 || min > max {
+		return 0, 0, fmt.Errorf("invalid status range %q", spec)
+	}
+	return min, max, nil
+}
+
+// ValidateStatus checks that every expected status specification is valid.
+func ValidateStatus(expected []string) error {
+	for _, spec := range expected {
+		if _, _, err := parseStatusRange(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MatchStatus returns true if the status code is expected, if no expected
+// status is specified, only 200 is considered valid.
+func MatchStatus(expected []string, code int) bool {
+	if len(expected) == 0 {
+		return code == 200
+	}
+	for _, spec := range expected {
+		min, max, err := parseStatusRange(spec)
+		if err != nil {
+			continue
+		}
+		if code >= min && code <= max {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package neverdown
+
+import (
+	"html/template"
+	"sort"
+	"time"
+)
+
+// StatusPageTitle is the title of the public status page.
+var StatusPageTitle = "Status"
+
+// StatusPageDays is the number of days displayed in the uptime bars.
+var StatusPageDays = 90
+
+// StatusPageIncidentsDays is the number of days recent incidents are displayed.
+var StatusPageIncidentsDays = 7
+
+// StatusPage is the public status page, only public checks are displayed.
+type StatusPage struct {
+	Title      string             `json:"title"`
+	Status     string             `json:"status"`
+	Components []*StatusComponent `json:"components"`
+	Incidents  []*PublicIncident  `json:"incidents"`
+	Updated    int64              `json:"updated"`
+}
+
+// StatusComponent groups public checks.
+type StatusComponent struct {
+	Name   string         `json:"name"`
+	Status string         `json:"status"`
+	Checks []*StatusCheck `json:"checks"`
+}
+
+// StatusCheck is the public view of a check.
+type StatusCheck struct {
+	ID     string       `json:"id"`
+	Name   string       `json:"name"`
+	Status string       `json:"status"`
+	Uptime float64      `json:"uptime"`
+	Days   []*StatusDay `json:"days"`
+}
+
+// StatusDay is the uptime of a check for a single day, Uptime is nil if
+// the check wasn't monitored that day.
+type StatusDay struct {
+	Date     string   `json:"date"`
+	Uptime   *float64 `json:"uptime"`
+	Downtime int64    `json:"downtime"`
+}
+
+// PublicIncident is the public view of an incident (errors are not exposed).
+type PublicIncident struct {
+	ID       string `json:"id"`
+	CheckID  string `json:"check_id"`
+	Name     string `json:"name"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Duration int64  `json:"duration"`
+}
+
+// DisplayName returns the name of the check displayed publicly.
+func (c *Check) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.ID
+}
+
+// worstStatus returns the worst of the two status.
+func worstStatus(a, b string) string {
+	rank := map[string]int{StatusUp: 0, StatusDegraded: 1, StatusDown: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// NewStatusPage builds the status page from the public checks of the Store.
+func NewStatusPage(s *Store, now time.Time) *StatusPage {
+	page := &StatusPage{
+		Title:      StatusPageTitle,
+		Status:     StatusUp,
+		Components: []*StatusComponent{},
+		Incidents:  []*PublicIncident{},
+		Updated:    now.Unix(),
+	}
+	components := map[string]*StatusComponent{}
+	checks := []*Check{}
+	for _, check := range s.Checks() {
+		if check.Public {
+			checks = append(checks, check)
+		}
+	}
+	sort.Sort(byID(checks))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for _, check := range checks {
+		incidents := s.Incidents(check.ID)
+		from := today.AddDate(0, 0, -StatusPageDays+1)
+		sc := &StatusCheck{
+			ID:     check.ID,
+			Name:   check.DisplayName(),
+			Status: check.Status,
+			Uptime: ComputeSLA(check, incidents, from, now, now).Uptime,
+			Days:   []*StatusDay{},
+		}
+		for day := from; !day.After(today); day = day.AddDate(0, 0, 1) {
+			sla := ComputeSLA(check, incidents, day, day.AddDate(0, 0, 1), now)
+			sd := &StatusDay{Date: day.Format("2006-01-02")}
+			if sla.Monitored > 0 {
+				uptime := sla.Uptime
+				sd.Uptime = &uptime
+				sd.Downtime = sla.Downtime
+			}
+			sc.Days = append(sc.Days, sd)
+		}
+		component, ok := components[check.Component]
+		if !ok {
+			component = &StatusComponent{
+				Name:   check.Component,
+				Status: StatusUp,
+				Checks: []*StatusCheck{},
+			}
+			components[check.Component] = component
+			page.Components = append(page.Components, component)
+		}
+		component.Checks = append(component.Checks, sc)
+		component.Status = worstStatus(component.Status, check.Status)
+		page.Status = worstStatus(page.Status, check.Status)
+		since := now.AddDate(0, 0, -StatusPageIncidentsDays).Unix()
+		for _, incident := range incidents {
+			if incident.End == 0 || incident.End >= since {
+				page.Incidents = append(page.Incidents, &PublicIncident{
+					ID:       incident.ID,
+					CheckID:  check.ID,
+					Name:     check.DisplayName(),
+					Start:    incident.Start,
+					End:      incident.End,
+					Duration: incident.Duration,
+				})
+			}
+		}
+	}
+	sort.Sort(componentByName(page.Components))
+	sort.Sort(publicIncidentByStart(page.Incidents))
+	return page
+}
+
+type componentByName []*StatusComponent
+
+func (s componentByName) Len() int           { return len(s) }
+func (s componentByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s componentByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+type publicIncidentByStart []*PublicIncident
+
+func (s publicIncidentByStart) Len() int           { return len(s) }
+func (s publicIncidentByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s publicIncidentByStart) Less(i, j int) bool { return s[i].Start > s[j].Start }
+
+var statusPageFuncs = template.FuncMap{
+	"time": func(ts int64) string {
+		return time.Unix(ts, 0).UTC().Format("2006-01-02 15:04 MST")
+	},
+	"duration": func(seconds int64) string {
+		return (time.Duration(seconds) * time.Second).String()
+	},
+	"barColor": func(day *StatusDay) string {
+		switch {
+		case day.Uptime == nil:
+			return "#ddd"
+		case *day.Uptime >= 99.9:
+			return "#2ecc71"
+		case *day.Uptime >= 99:
+			return "#f1c40f"
+		default:
+			return "#e74c3c"
+		}
+	},
+	"deref": func(f *float64) float64 {
+		return *f
+	},
+}
+
+var statusPageTpl = template.Must(template.New("status page").Funcs(statusPageFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 860px; margin: 2em auto; color: #333; }
+.status { padding: 1em; color: #fff; border-radius: 4px; }
+.up { background: #2ecc71; } .degraded { background: #f1c40f; } .down { background: #e74c3c; }
+.check { margin: 1em 0; }
+.check .state { float: right; }
+.bars { display: flex; height: 30px; }
+.bars span { flex: 1; margin-right: 1px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="status {{.Status}}">{{if eq .Status "up"}}All systems operational{{else if eq .Status "degraded"}}Degraded performance{{else}}Partial outage{{end}}</div>
+{{range .Components}}
+<h2>{{if .Name}}{{.Name}}{{else}}Services{{end}}</h2>
+{{range .Checks}}
+<div class="check">
+<strong>{{.Name}}</strong> <span class="state">{{.Status}} &middot; {{printf "%.2f" .Uptime}}%</span>
+<div class="bars">{{range .Days}}<span style="background: {{barColor .}}" title="{{.Date}}{{if .Uptime}}: {{printf "%.2f" (deref .Uptime)}}%{{else}}: no data{{end}}"></span>{{end}}</div>
+</div>
+{{end}}
+{{end}}
+<h2>Incidents</h2>
+{{range .Incidents}}
+<p><strong>{{.Name}}</strong>: {{if .End}}resolved, down from {{time .Start}} to {{time .End}} ({{duration .Duration}}){{else}}ongoing since {{time .Start}}{{end}}</p>
+{{else}}
+<p>No recent incidents.</p>
+{{end}}
+<p><small>Updated {{time .Updated}}</small></p>
+</body>
+</html>
+`))
@@ -10,7 +10,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
+	"net"
+	"net/http"
+	"net/mail"
+	nurl "net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -27,6 +32,10 @@ func uuid() string {
 type Store struct {
 	ChecksIndex          map[string]*Check
 	PendingWebHooksIndex map[string]*WebHook
+	HistoryIndex         map[string][]*Result
+	IncidentsIndex       map[string]*Incident
+	DeliveriesLog        []*Delivery
+	DeadWebHooksIndex    map[string]*WebHook
 	mu                   sync.Mutex
 }
 
@@ -35,6 +44,10 @@ func NewStore() *Store {
 	return &Store{
 		ChecksIndex:          map[string]*Check{},
 		PendingWebHooksIndex: map[string]*WebHook{},
+		HistoryIndex:         map[string][]*Result{},
+		IncidentsIndex:       map[string]*Incident{},
+		DeliveriesLog:        []*Delivery{},
+		DeadWebHooksIndex:    map[string]*WebHook{},
 	}
 }
 
@@ -42,24 +55,65 @@ func NewStore() *Store {
 func (s *Store) JSON() ([]byte, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	checks := []*Check{}
-	pendingWebhooks := []*WebHook{}
+	checks := []*fsmCheck{}
+	pendingWebhooks := []*fsmWebHook{}
 	for _, c := range s.ChecksIndex {
-		checks = append(checks, c)
+		checks = append(checks, (*fsmCheck)(c))
 	}
 	for _, wh := range s.PendingWebHooksIndex {
-		pendingWebhooks = append(pendingWebhooks, wh)
+		pendingWebhooks = append(pendingWebhooks, (*fsmWebHook)(wh))
+	}
+	deadWebhooks := []*fsmWebHook{}
+	for _, wh := range s.DeadWebHooksIndex {
+		deadWebhooks = append(deadWebhooks, (*fsmWebHook)(wh))
+	}
+	incidents := []*Incident{}
+	for _, incident := range s.IncidentsIndex {
+		incidents = append(incidents, incident)
 	}
 	data := map[string]interface{}{
 		"checks":           checks,
 		"pending_webhooks": pendingWebhooks,
+		"history":          s.HistoryIndex,
+		"incidents":        incidents,
+		"deliveries":       s.DeliveriesLog,
+		"dead_webhooks":    deadWebhooks,
 	}
 	return json.Marshal(&data)
 }
 
 type JSONStore struct {
-	Checks          []*Check   `json:"checks"`
-	PendingWebHooks []*WebHook `json:"pending_webhooks"`
+	Checks          []json.RawMessage    `json:"checks"`
+	PendingWebHooks []*WebHook           `json:"pending_webhooks"`
+	History         map[string][]*Result `json:"history"`
+	Incidents       []*Incident          `json:"incidents"`
+	Deliveries      []*Delivery          `json:"deliveries"`
+	DeadWebHooks    []*WebHook           `json:"dead_webhooks"`
+}
+
+// decodeCheck decodes a JSON encoded Check, missing fields are set to their default values.
+func decodeCheck(data []byte) (*Check, error) {
+	check := NewCheck()
+	if err := json.Unmarshal(data, check); err != nil {
+		return nil, err
+	}
+	if check.WebHooks == nil {
+		check.WebHooks = []string{}
+	}
+	for _, target := range check.WebHookTargets {
+		target.compile()
+	}
+	for _, assertion := range check.Assertions {
+		assertion.compile()
+	}
+	// Checks stored before the status field was introduced
+	if !check.Up && check.Status == StatusUp {
+		check.Status = StatusDown
+	}
+	if check.LastCheck != 0 {
+		check.Prev = time.Unix(check.LastCheck, 0).UTC()
+	}
+	return check, nil
 }
 
 // FromJSON loads the store from a JSON export.
@@ -70,12 +124,31 @@ func (s *Store) FromJSON(r io.Reader) error {
 	if err := json.NewDecoder(r).Decode(&data); err != nil {
 		return err
 	}
-	for _, check := range data.Checks {
+	for _, js := range data.Checks {
+		check, err := decodeCheck(js)
+		if err != nil {
+			return err
+		}
 		s.ChecksIndex[check.ID] = check
 	}
 	for _, webhook := range data.PendingWebHooks {
 		s.PendingWebHooksIndex[webhook.ID] = webhook
 	}
+	for checkID, history := range data.History {
+		// Drop the orphan history left by older versions
+		if _, exists := s.ChecksIndex[checkID]; exists {
+			s.HistoryIndex[checkID] = history
+		}
+	}
+	for _, incident := range data.Incidents {
+		s.IncidentsIndex[incident.ID] = incident
+	}
+	if data.Deliveries != nil {
+		s.DeliveriesLog = data.Deliveries
+	}
+	for _, webhook := range data.DeadWebHooks {
+		s.DeadWebHooksIndex[webhook.ID] = webhook
+	}
 	return nil
 }
 
@@ -84,29 +157,92 @@ func (s *Store) ExecCommand(data []byte) error {
 	cmdType := data[0]
 	switch cmdType {
 	case 0:
-		check := NewCheck()
-		if err := json.Unmarshal(data[1:], check); err != nil {
+		check, err := decodeCheck(data[1:])
+		if err != nil {
 			return err
 		}
-		if check.WebHooks == nil {
-			check.WebHooks = []string{}
-		}
-		if check.LastCheck != 0 {
-			check.Prev = time.Unix(check.LastCheck, 0).UTC()
+		s.mu.Lock()
+		if old, exists := s.ChecksIndex[check.ID]; exists {
+			check.mergeHeartbeats(old)
 		}
 		s.ChecksIndex[check.ID] = check
+		s.mu.Unlock()
 	case 1:
 		checkID := string(data[1:])
+		s.mu.Lock()
 		delete(s.ChecksIndex, checkID)
+		delete(s.HistoryIndex, checkID)
+		for id, incident := range s.IncidentsIndex {
+			if incident.CheckID == checkID {
+				delete(s.IncidentsIndex, id)
+			}
+		}
+		s.mu.Unlock()
 	case 2:
 		webhook := NewWebHook()
 		if err := json.Unmarshal(data[1:], webhook); err != nil {
 			return err
 		}
+		s.mu.Lock()
 		s.PendingWebHooksIndex[webhook.ID] = webhook
+		s.mu.Unlock()
 	case 3:
 		webhookID := string(data[1:])
+		s.mu.Lock()
 		delete(s.PendingWebHooksIndex, webhookID)
+		s.mu.Unlock()
+	case 4:
+		hb := &Heartbeat{}
+		if err := json.Unmarshal(data[1:], hb); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		check, exists := s.ChecksIndex[hb.CheckID]
+		if !exists {
+			return fmt.Errorf("unknown check %v", hb.CheckID)
+		}
+		return hb.Apply(check)
+	case 5:
+		res := &Result{}
+		if err := json.Unmarshal(data[1:], res); err != nil {
+			return err
+		}
+		s.AddResult(res)
+	case 10:
+		results := Results{}
+		if err := json.Unmarshal(data[1:], &results); err != nil {
+			return err
+		}
+		for _, res := range results {
+			s.AddResult(res)
+		}
+	case 6:
+		incident := &Incident{}
+		if err := json.Unmarshal(data[1:], incident); err != nil {
+			return err
+		}
+		s.AddIncident(incident)
+	case 7:
+		d := &Delivery{}
+		if err := json.Unmarshal(data[1:], d); err != nil {
+			return err
+		}
+		s.AddDelivery(d)
+	case 8:
+		webhook := NewWebHook()
+		if err := json.Unmarshal(data[1:], webhook); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		delete(s.PendingWebHooksIndex, webhook.ID)
+		s.DeadWebHooksIndex[webhook.ID] = webhook
+		s.mu.Unlock()
+	case 9:
+		webhookID := string(data[1:])
+		s.mu.Lock()
+		delete(s.DeadWebHooksIndex, webhookID)
+		s.mu.Unlock()
 
 	default:
 		panic("unknow cmd type")
@@ -114,28 +250,312 @@ func (s *Store) ExecCommand(data []byte) error {
 	return nil
 }
 
+// Checks returns a copy of every checks.
+func (s *Store) Checks() []*Check {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checks := []*Check{}
+	for _, check := range s.ChecksIndex {
+		checks = append(checks, check.Copy())
+	}
+	return checks
+}
+
+// Check returns a copy of the check with the given ID, or nil.
+func (s *Store) Check(id string) *Check {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	check, ok := s.ChecksIndex[id]
+	if !ok {
+		return nil
+	}
+	return check.Copy()
+}
+
 // Check represent an active monitoring check
 type Check struct {
 	ID         string      `json:"id"`
+	Type       string      `json:"type"`
 	URL        string      `json:"url"`
 	Method     string      `json:"method"`
 	FirstCheck int64       `json:"first_check"`
 	LastCheck  int64       `json:"last_check"`
 	LastError  interface{} `json:"last_error"`
 	Up         bool        `json:"up"`
+	Status     string      `json:"status"`
+	PrevStatus string      `json:"prev_status,omitempty"`
 	LastDown   int64       `json:"last_down"`
 	Interval   int         `json:"interval"`
 	WebHooks   []string    `json:"webhooks"`
 	Emails     []string    `json:"emails"`
+	Slack      []string    `json:"slack"`
+	PagerDuty  string      `json:"pagerduty,omitempty"`
 	Pings      int         `json:"pings"`
 	Outages    int         `json:"outages"`
 	Uptime     float32     `json:"uptime"`
 	TimeDown   int64       `json:"time_down"`
 
+	// Uptimes holds the uptime percentage over the rolling windows (24h, 7d, 30d, 90d)
+	Uptimes map[string]float64 `json:"uptimes"`
+
+	// Public checks are displayed on the status page, grouped by Component
+	Name      string `json:"name,omitempty"`
+	Public    bool   `json:"public"`
+	Component string `json:"component,omitempty"`
+
+	// Labels are added to the check metrics
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Assertions are performed on the response body of HTTP checks.
+	Assertions []*Assertion `json:"assertions,omitempty"`
+	// ExpectedStatus lists the valid status codes ("204", "2xx", "200-399"), defaults to 200.
+	ExpectedStatus  []string `json:"expected_status,omitempty"`
+	FollowRedirects bool     `json:"follow_redirects"`
+	MaxRedirects    int      `json:"max_redirects"`
+
+	// The check is degraded if the response time exceeds WarnLatency,
+	// and down if it exceeds MaxLatency (in milliseconds, 0 to disable).
+	WarnLatency int `json:"warn_latency_ms"`
+	MaxLatency  int `json:"max_latency_ms"`
+
+	// Headers, Body and Auth customize the HTTP request ("Host" overrides the request host).
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Auth    *Auth             `json:"auth,omitempty"`
+
+	// WebHookTargets are webhooks with a custom request (method, headers and templated body)
+	WebHookTargets []*WebHookTarget `json:"webhook_targets,omitempty"`
+
+	// WebHookSecret signs the webhooks payload (defaults to the global WebHookSecret)
+	WebHookSecret string `json:"webhook_secret,omitempty"`
+
+	// SlackRetry, PagerDutyRetry and EmailRetry override the DefaultRetryPolicy
+	// of the Slack, PagerDuty and email notifications.
+	SlackRetry     *RetryPolicy `json:"slack_retry,omitempty"`
+	PagerDutyRetry *RetryPolicy `json:"pagerduty_retry,omitempty"`
+	EmailRetry     *RetryPolicy `json:"email_retry,omitempty"`
+
+	// CertExpiryDays enables the "cert_expiring" notification N days before
+	// the peer certificate expires (0 to disable).
+	CertExpiryDays int       `json:"cert_expiry_days"`
+	CertExpiring   bool      `json:"cert_expiring"`
+	Cert           *CertInfo `json:"cert,omitempty"`
+
+	// DNS checks query a RecordType (A by default) record and compare the answers
+	// with ExpectedAnswers (if any).
+	RecordType      string   `json:"record_type,omitempty"`
+	ExpectedAnswers []string `json:"expected_answers,omitempty"`
+
+	// The check status changes after FailureThreshold consecutive failures
+	// (or RecoveryThreshold consecutive successes).
+	FailureThreshold     int `json:"failure_threshold"`
+	RecoveryThreshold    int `json:"recovery_threshold"`
+	ConsecutiveFailures  int `json:"consecutive_failures"`
+	ConsecutiveSuccesses int `json:"consecutive_successes"`
+
+	// A check is flapping if the ratio of status changes in the last FlapWindow
+	// checks exceeds FlapThreshold (FlapWindow set to 0 disables flap detection).
+	FlapWindow    int      `json:"flap_window"`
+	FlapThreshold float64  `json:"flap_threshold"`
+	Flapping      bool     `json:"flapping"`
+	RecentStatus  []string `json:"recent_status,omitempty"`
+
+	// Heartbeat checks are down if no heartbeat is received within Interval + Grace seconds
+	Grace           int    `json:"grace"`
+	LastHeartbeat   int64  `json:"last_heartbeat"`
+	LastStart       int64  `json:"last_start"`
+	LastDuration    int64  `json:"last_duration"`
+	LastFail        int64  `json:"last_fail"`
+	LastFailMessage string `json:"last_fail_message,omitempty"`
+
+	// IncidentID is the ID of the current (or last) incident
+	IncidentID string `json:"incident_id,omitempty"`
+
+	// Timings of the latest check
+	Timings *Timings `json:"timings,omitempty"`
+
+	// Event is the last notification event ("status" or "cert_expiring").
+	Event string `json:"event,omitempty"`
+
 	Prev time.Time `json:"-"`
 	Next time.Time `json:"-"`
 }
 
+// Auth holds the credentials used by HTTP checks, Type is either "basic"
+// (Username/Password) or "bearer" (Token).
+type Auth struct {
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// Copy returns a copy of the check that can be modified (the stored checks
+// are only modified through raft). The slices, maps, Auth, Assertions and
+// WebHookTargets are copied, the retry policies, Cert and Timings are shared
+// (they're replaced, never modified in place), as are the compiled regexes
+// and templates.
+func (c *Check) Copy() *Check {
+	check := *c
+	check.WebHooks = copyStrings(c.WebHooks)
+	check.Emails = copyStrings(c.Emails)
+	check.Slack = copyStrings(c.Slack)
+	check.ExpectedStatus = copyStrings(c.ExpectedStatus)
+	check.ExpectedAnswers = copyStrings(c.ExpectedAnswers)
+	check.RecentStatus = append([]string(nil), c.RecentStatus...)
+	check.Headers = copyStringMap(c.Headers)
+	check.Labels = copyStringMap(c.Labels)
+	if c.Uptimes != nil {
+		check.Uptimes = map[string]float64{}
+		for window, uptime := range c.Uptimes {
+			check.Uptimes[window] = uptime
+		}
+	}
+	if c.Auth != nil {
+		auth := *c.Auth
+		check.Auth = &auth
+	}
+	if c.Assertions != nil {
+		check.Assertions = []*Assertion{}
+		for _, assertion := range c.Assertions {
+			a := *assertion
+			check.Assertions = append(check.Assertions, &a)
+		}
+	}
+	if c.WebHookTargets != nil {
+		check.WebHookTargets = []*WebHookTarget{}
+		for _, target := range c.WebHookTargets {
+			t := *target
+			t.Headers = copyStringMap(target.Headers)
+			check.WebHookTargets = append(check.WebHookTargets, &t)
+		}
+	}
+	return &check
+}
+
+// copyStrings returns a copy of the slice (nil stays nil).
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+// copyStringMap returns a copy of the map (nil stays nil).
+func copyStringMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	copied := map[string]string{}
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
+
+// RedactedSecret replaces the secrets in the API responses and the notifications.
+const RedactedSecret = "***"
+
+// fsmCheck is used to serialize a Check in the FSM (raft log and snapshots)
+// and to the peers, secrets included.
+type fsmCheck Check
+
+// MarshalJSON implements json.Marshaler, the secrets are redacted.
+func (c *Check) MarshalJSON() ([]byte, error) {
+	return json.Marshal((*fsmCheck)(c.Redacted()))
+}
+
+// Redacted returns a copy of the check with the secrets (auth password and
+// token, headers values, webhook targets headers values, webhook secret and
+// PagerDuty routing key) redacted.
+func (c *Check) Redacted() *Check {
+	redacted := *c
+	if c.WebHookSecret != "" {
+		redacted.WebHookSecret = RedactedSecret
+	}
+	if c.PagerDuty != "" {
+		redacted.PagerDuty = RedactedSecret
+	}
+	if c.Auth != nil {
+		auth := *c.Auth
+		if auth.Password != "" {
+			auth.Password = RedactedSecret
+		}
+		if auth.Token != "" {
+			auth.Token = RedactedSecret
+		}
+		redacted.Auth = &auth
+	}
+	redacted.Headers = redactHeaders(c.Headers)
+	if c.WebHookTargets != nil {
+		redacted.WebHookTargets = []*WebHookTarget{}
+		for _, target := range c.WebHookTargets {
+			rtarget := *target
+			rtarget.Headers = redactHeaders(target.Headers)
+			redacted.WebHookTargets = append(redacted.WebHookTargets, &rtarget)
+		}
+	}
+	return &redacted
+}
+
+// redactHeaders returns a copy of the headers with every value redacted (the
+// headers usually hold API keys and tokens).
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := map[string]string{}
+	for name, value := range headers {
+		if value != "" {
+			value = RedactedSecret
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+// keepHeaders restores the redacted headers values from the old headers.
+func keepHeaders(headers, old map[string]string) {
+	for name, value := range headers {
+		if value != RedactedSecret {
+			continue
+		}
+		for oldName, oldValue := range old {
+			if http.CanonicalHeaderKey(oldName) == http.CanonicalHeaderKey(name) {
+				headers[name] = oldValue
+			}
+		}
+	}
+}
+
+// keepSecrets restores the redacted secrets of an updated check from the existing
+// check, the webhook targets headers are restored from the target with the same URL.
+func (c *Check) keepSecrets(old *Check) {
+	if c.WebHookSecret == RedactedSecret {
+		c.WebHookSecret = old.WebHookSecret
+	}
+	if c.PagerDuty == RedactedSecret {
+		c.PagerDuty = old.PagerDuty
+	}
+	if c.Auth != nil && old.Auth != nil {
+		if c.Auth.Password == RedactedSecret {
+			c.Auth.Password = old.Auth.Password
+		}
+		if c.Auth.Token == RedactedSecret {
+			c.Auth.Token = old.Auth.Token
+		}
+	}
+	keepHeaders(c.Headers, old.Headers)
+	for _, target := range c.WebHookTargets {
+		for _, oldTarget := range old.WebHookTargets {
+			if oldTarget.URL == target.URL {
+				keepHeaders(target.Headers, oldTarget.Headers)
+				break
+			}
+		}
+	}
+}
+
 // NewCheck initialize an empty Check, generates an ID.
 func NewCheck() *Check {
 	return &Check{
@@ -143,11 +563,172 @@ func NewCheck() *Check {
 		Next:     time.Time{},
 		WebHooks: []string{},
 		Emails:   []string{},
+		Slack:    []string{},
 		Method:   "HEAD",
 		Uptime:   100.0,
 		Interval: 60, // 60 seconds resolution between checks if no interval is provided.
 		Up:       true,
+		Status:   StatusUp,
+
+		FollowRedirects:   true,
+		MaxRedirects:      10,
+		FailureThreshold:  1,
+		RecoveryThreshold: 1,
+		FlapWindow:        DefaultFlapWindow,
+		FlapThreshold:     DefaultFlapThreshold,
+	}
+}
+
+// Check status
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Notification events
+const (
+	EventStatus        = "status"
+	EventCertExpiring  = "cert_expiring"
+	EventFlappingStart = "flapping_start"
+	EventFlappingStop  = "flapping_stop"
+)
+
+// CertExpiresSoon returns true if the peer certificate will expire in less
+// than CertExpiryDays days.
+func (c *Check) CertExpiresSoon(now time.Time) bool {
+	if c.Cert == nil || c.CertExpiryDays <= 0 {
+		return false
+	}
+	limit := now.AddDate(0, 0, c.CertExpiryDays)
+	return time.Unix(c.Cert.NotAfter, 0).Before(limit)
+}
+
+// Validate checks the check configuration before it is stored.
+func (c *Check) Validate() error {
+	c.Type = c.CheckType()
+	if c.URL == "" && c.Type != "heartbeat" {
+		return fmt.Errorf("missing url")
+	}
+	if c.Type == "tcp" || c.Type == "tls" {
+		u, err := nurl.Parse(c.URL)
+		if err != nil {
+			return fmt.Errorf("invalid %v url %q: %v", c.Type, c.URL, err)
+		}
+		if u.Hostname() == "" {
+			return fmt.Errorf("missing host in %q", c.URL)
+		}
+		// The port is required for tcp checks (tls checks default to 443)
+		if _, port, err := net.SplitHostPort(u.Host); err == nil || c.Type == "tcp" {
+			if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+				return fmt.Errorf("invalid port in %q", c.URL)
+			}
+		}
+	}
+	if c.Type == "dns" {
+		u, err := nurl.Parse(c.URL)
+		if err != nil {
+			return fmt.Errorf("invalid dns url %q: %v", c.URL, err)
+		}
+		if strings.Trim(u.Path, "/") == "" {
+			return fmt.Errorf("missing dns name in %q", c.URL)
+		}
+		if c.RecordType == "" {
+			c.RecordType = "A"
+		}
+		c.RecordType = strings.ToUpper(c.RecordType)
+		valid := false
+		for _, recordType := range DNSRecordTypes {
+			if c.RecordType == recordType {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unsupported record type %q", c.RecordType)
+		}
+	} else if c.RecordType != "" || len(c.ExpectedAnswers) > 0 {
+		return fmt.Errorf("record_type and expected_answers are only supported by dns checks")
+	}
+	for _, target := range c.WebHookTargets {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+	}
+	// The name and URL are used in the alert emails subject
+	if strings.ContainsAny(c.Name, "\r\n") || strings.ContainsAny(c.URL, "\r\n") {
+		return fmt.Errorf("the name and url can't contain line breaks")
+	}
+	for i, email := range c.Emails {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || strings.ContainsAny(email, "\r\n") {
+			return fmt.Errorf("invalid email %q", email)
+		}
+		c.Emails[i] = addr.Address
+	}
+	for _, slackURL := range c.Slack {
+		if !strings.HasPrefix(slackURL, "https://") {
+			return fmt.Errorf("invalid slack webhook url %q", slackURL)
+		}
+	}
+	for _, retry := range []*RetryPolicy{c.SlackRetry, c.PagerDutyRetry, c.EmailRetry} {
+		if retry == nil {
+			continue
+		}
+		if err := retry.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.FailureThreshold < 1 || c.RecoveryThreshold < 1 {
+		return fmt.Errorf("failure_threshold and recovery_threshold must be at least 1")
+	}
+	if c.FlapWindow < 0 || c.FlapThreshold <= 0 || c.FlapThreshold > 1 {
+		return fmt.Errorf("invalid flap detection settings")
+	}
+	if c.Grace < 0 {
+		return fmt.Errorf("invalid grace %v", c.Grace)
+	}
+	if _, ok := Checkers[c.Type]; !ok {
+		return fmt.Errorf("unknown check type %q", c.Type)
 	}
+	if c.CertExpiryDays < 0 {
+		return fmt.Errorf("invalid cert_expiry_days %v", c.CertExpiryDays)
+	}
+	if err := ValidateLabels(c.Labels); err != nil {
+		return err
+	}
+	if err := ValidateStatus(c.ExpectedStatus); err != nil {
+		return err
+	}
+	if c.WarnLatency < 0 || c.MaxLatency < 0 {
+		return fmt.Errorf("invalid latency threshold")
+	}
+	if c.WarnLatency > 0 && c.MaxLatency > 0 && c.WarnLatency > c.MaxLatency {
+		return fmt.Errorf("warn_latency_ms must be lower than max_latency_ms")
+	}
+	if c.MaxRedirects < 0 {
+		return fmt.Errorf("invalid max_redirects %v", c.MaxRedirects)
+	}
+	if c.Auth != nil && c.Auth.Type != "basic" && c.Auth.Type != "bearer" {
+		return fmt.Errorf("unknown auth type %q", c.Auth.Type)
+	}
+	if c.Body != "" && c.Method == "HEAD" {
+		return fmt.Errorf("a body can't be sent with a HEAD request")
+	}
+	for _, assertion := range c.Assertions {
+		if err := assertion.Validate(); err != nil {
+			return err
+		}
+	}
+	if len(c.Assertions) > 0 {
+		if c.Type != "http" {
+			return fmt.Errorf("assertions are only supported by http checks")
+		}
+		// HEAD responses have no body
+		if c.Method == "HEAD" {
+			c.Method = "GET"
+		}
+	}
+	return nil
 }
 
 // ComputeNext computes the next check execution time
@@ -166,7 +747,7 @@ func (c *Check) ComputeNext(now time.Time) {
 
 // ToPostCmd serializes a Check into a raft transition (POST command).
 func (c *Check) ToPostCmd() []byte {
-	js, err := json.Marshal(c)
+	js, err := json.Marshal((*fsmCheck)(c))
 	if err != nil {
 		panic(err)
 	}
@@ -212,12 +793,49 @@ func (s webhookByTime) Less(i, j int) bool {
 
 // WebHook represent a waiting webhook notification that hasn't been successfully executed.
 type WebHook struct {
-	ID       string    `json:"id"`
+	ID string `json:"id"`
+	// Kind is the notifier that created the WebHook ("webhook", "slack"...)
+	Kind     string    `json:"kind,omitempty"`
 	URL      string    `json:"url"`
 	Payload  []byte    `json:"payload"`
 	Tries    int       `json:"tries"`
 	FirstTry int64     `json:"first_try"`
 	Next     time.Time `json:"-"`
+	// Secret is used to sign the payload on every retry (only serialized in the FSM)
+	Secret string `json:"secret,omitempty"`
+	// Method (POST by default), Headers and Timeout (in seconds) of the webhook request
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout int               `json:"timeout,omitempty"`
+	CheckID string            `json:"check_id,omitempty"`
+	// Deliveries is the log of the delivery attempts
+	Deliveries []*Delivery `json:"deliveries"`
+	// DeadAt is set when the WebHook is moved to the dead-letter queue
+	DeadAt int64 `json:"dead_at,omitempty"`
+	// NextTry is the time of the next retry, Retry overrides the DefaultRetryPolicy
+	NextTry int64        `json:"next_try"`
+	Retry   *RetryPolicy `json:"retry,omitempty"`
+}
+
+// fsmWebHook is used to serialize a WebHook in the FSM, secret included.
+type fsmWebHook WebHook
+
+// MarshalJSON implements json.Marshaler, the secret is omitted and the headers
+// values and the PagerDuty routing key are redacted.
+func (wh *WebHook) MarshalJSON() ([]byte, error) {
+	redacted := *wh
+	redacted.Secret = ""
+	redacted.Headers = redactHeaders(wh.Headers)
+	if wh.Kind == "pagerduty" {
+		event := &PagerDutyEvent{}
+		if err := json.Unmarshal(wh.Payload, event); err == nil {
+			event.RoutingKey = RedactedSecret
+			if redacted.Payload, err = json.Marshal(event); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return json.Marshal((*fsmWebHook)(&redacted))
 }
 
 // NewWebHook initialize an empty WebHook.
@@ -227,24 +845,26 @@ func NewWebHook() *WebHook {
 	}
 }
 
-// ComputeNext computes the next check execution time
+// ComputeNext computes the next retry time given the WebHook retry policy,
+// NextTry is persisted so the schedule survives a snapshot restore.
 func (wh *WebHook) ComputeNext(now time.Time) {
-	elapsed := now.Sub(wh.Next)
-	// Exponential backoff retry
-	delay := time.Duration(math.Pow(float64(2), float64(wh.Tries))/2) * time.Second
-	if elapsed > 0 {
-		if wh.Next.IsZero() {
-			wh.Next = now.Add(delay)
-		} else {
-			wh.Next = wh.Next.Add(delay)
-		}
+	wh.Next = now.Add(wh.Policy().Delay(wh.Tries))
+	wh.NextTry = wh.Next.Unix()
+}
+
+// restoreNext restores the next retry time from NextTry (Next is not serialized).
+func (wh *WebHook) restoreNext(now time.Time) {
+	if wh.NextTry == 0 {
+		// WebHooks stored before NextTry was introduced
+		wh.ComputeNext(now)
+		return
 	}
-	return
+	wh.Next = time.Unix(wh.NextTry, 0).UTC()
 }
 
 // ToPostCmd serializes a WebHook into a raft POST command
 func (wh *WebHook) ToPostCmd() []byte {
-	js, err := json.Marshal(wh)
+	js, err := json.Marshal((*fsmWebHook)(wh))
 	if err != nil {
 		panic(err)
 	}
@@ -262,3 +882,48 @@ func (wh *WebHook) ToDeleteCmd() []byte {
 	copy(msg[1:], buuid)
 	return msg
 }
+
+// PendingWebHooks returns a copy of the pending webhooks.
+func (s *Store) PendingWebHooks() []*WebHook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyWebHooks(s.PendingWebHooksIndex)
+}
+
+// PendingWebHook returns a copy of the pending webhook with the given ID, or nil.
+func (s *Store) PendingWebHook(id string) *WebHook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyWebHook(s.PendingWebHooksIndex[id])
+}
+
+// DeadWebHooks returns a copy of the webhooks in the dead-letter queue.
+func (s *Store) DeadWebHooks() []*WebHook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyWebHooks(s.DeadWebHooksIndex)
+}
+
+// DeadWebHook returns a copy of the dead webhook with the given ID, or nil.
+func (s *Store) DeadWebHook(id string) *WebHook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyWebHook(s.DeadWebHooksIndex[id])
+}
+
+func copyWebHooks(index map[string]*WebHook) []*WebHook {
+	webhooks := []*WebHook{}
+	for _, wh := range index {
+		webhooks = append(webhooks, copyWebHook(wh))
+	}
+	return webhooks
+}
+
+func copyWebHook(wh *WebHook) *WebHook {
+	if wh == nil {
+		return nil
+	}
+	webhook := *wh
+	webhook.Deliveries = append([]*Delivery{}, wh.Deliveries...)
+	return &webhook
+}
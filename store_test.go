@@ -0,0 +1,162 @@
+package neverdown
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCheckRedactedAuth(t *testing.T) {
+	for _, auth := range []*Auth{
+		&Auth{Type: "basic", Username: "admin", Password: "s3cr3t"},
+		&Auth{Type: "bearer", Token: "s3cr3t"},
+	} {
+		check := NewCheck()
+		check.ID = "redacted"
+		check.Auth = auth
+		js, err := json.Marshal(check)
+		if err != nil {
+			t.Fatalf("failed to marshal the check: %v", err)
+		}
+		if bytes.Contains(js, []byte("s3cr3t")) {
+			t.Errorf("secret leaked in %s", js)
+		}
+		if auth.Password != "s3cr3t" && auth.Token != "s3cr3t" {
+			t.Errorf("the check auth was modified: %+v", auth)
+		}
+
+		// The FSM command keeps the secret
+		if !bytes.Contains(check.ToPostCmd(), []byte("s3cr3t")) {
+			t.Errorf("secret missing from the post command")
+		}
+
+		// Posting back the redacted check keeps the secret
+		updated := NewCheck()
+		if err := json.Unmarshal(js, updated); err != nil {
+			t.Fatalf("failed to unmarshal the check: %v", err)
+		}
+		updated.keepSecrets(check)
+		if *updated.Auth != *auth {
+			t.Errorf("secret not restored, got %+v, expected %+v", updated.Auth, auth)
+		}
+	}
+}
+
+func TestCheckRedactedHeaders(t *testing.T) {
+	check := NewCheck()
+	check.ID = "redacted"
+	check.Headers = map[string]string{"X-Api-Key": "s3cr3t-key"}
+	check.PagerDuty = "s3cr3t-routing"
+	check.WebHookTargets = []*WebHookTarget{
+		&WebHookTarget{URL: "http://example.com/hook", Headers: map[string]string{"Authorization": "Bearer s3cr3t-token"}},
+	}
+	js, err := json.Marshal(check)
+	if err != nil {
+		t.Fatalf("failed to marshal the check: %v", err)
+	}
+	if bytes.Contains(js, []byte("s3cr3t")) {
+		t.Errorf("secret leaked in %s", js)
+	}
+	if check.Headers["X-Api-Key"] != "s3cr3t-key" || check.WebHookTargets[0].Headers["Authorization"] != "Bearer s3cr3t-token" {
+		t.Errorf("the check headers were modified")
+	}
+
+	// Posting back the redacted check keeps the secrets
+	updated := NewCheck()
+	if err := json.Unmarshal(js, updated); err != nil {
+		t.Fatalf("failed to unmarshal the check: %v", err)
+	}
+	updated.Headers["X-Other"] = "value"
+	updated.keepSecrets(check)
+	if updated.Headers["X-Api-Key"] != "s3cr3t-key" || updated.Headers["X-Other"] != "value" {
+		t.Errorf("headers not restored, got %v", updated.Headers)
+	}
+	if updated.WebHookTargets[0].Headers["Authorization"] != "Bearer s3cr3t-token" {
+		t.Errorf("webhook target headers not restored, got %v", updated.WebHookTargets[0].Headers)
+	}
+	if updated.PagerDuty != "s3cr3t-routing" {
+		t.Errorf("PagerDuty routing key not restored, got %v", updated.PagerDuty)
+	}
+
+	// The queued PagerDuty events and webhooks are redacted too
+	payload, _ := json.Marshal(NewPagerDutyEvent(check, "trigger"))
+	for _, wh := range []*WebHook{
+		&WebHook{Kind: "pagerduty", Payload: payload},
+		check.WebHookTargets[0].ToWebHook([]byte("{}"), ""),
+	} {
+		js, err := json.Marshal(wh)
+		if err != nil {
+			t.Fatalf("failed to marshal the webhook: %v", err)
+		}
+		if bytes.Contains(js, []byte("s3cr3t")) {
+			t.Errorf("secret leaked in %s", js)
+		}
+		restored := &WebHook{}
+		if err := json.Unmarshal(wh.ToPostCmd()[1:], restored); err != nil {
+			t.Fatalf("failed to unmarshal the command: %v", err)
+		}
+		if !bytes.Contains(restored.Payload, []byte("s3cr3t")) && !strings.Contains(restored.Headers["Authorization"], "s3cr3t") {
+			t.Errorf("secret missing from the post command")
+		}
+	}
+}
+
+func TestStoreChecksConcurrentAccess(t *testing.T) {
+	s := NewStore()
+	check := NewCheck()
+	check.ID = "concurrent"
+	if err := s.ExecCommand(check.ToPostCmd()); err != nil {
+		t.Fatalf("failed to apply the check: %v", err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if err := s.ExecCommand(check.ToPostCmd()); err != nil {
+				t.Errorf("failed to apply the check: %v", err)
+			}
+			if err := s.ExecCommand(NewHeartbeat(check.ID, HeartbeatPing).ToCmd()); err != nil {
+				t.Errorf("failed to apply the heartbeat: %v", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			for _, c := range s.Checks() {
+				c.Status = StatusDown
+				c.RecordStatus()
+			}
+		}
+	}()
+	wg.Wait()
+	if stored := s.Check(check.ID); stored == nil || stored.Status != StatusUp || stored.LastHeartbeat == 0 {
+		t.Errorf("unexpected stored check %+v", stored)
+	}
+}
+
+func TestCheckCopy(t *testing.T) {
+	check := NewCheck()
+	check.Emails = []string{"ops@example.com"}
+	check.Headers = map[string]string{"X-Api-Key": "key"}
+	check.Labels = map[string]string{"team": "ops"}
+	check.Auth = &Auth{Type: "bearer", Token: "token"}
+	check.Assertions = []*Assertion{&Assertion{Contains: "ok"}}
+	check.WebHookTargets = []*WebHookTarget{&WebHookTarget{URL: "http://example.com/hook", Headers: map[string]string{"X-Source": "neverdown"}}}
+	c := check.Copy()
+	c.Emails[0] = "dev@example.com"
+	c.Headers["X-Api-Key"] = "other"
+	c.Labels["team"] = "dev"
+	c.Auth.Token = "other"
+	c.Assertions[0].Contains = "other"
+	c.WebHookTargets[0].URL = "http://example.com/other"
+	c.WebHookTargets[0].Headers["X-Source"] = "other"
+	if check.Emails[0] != "ops@example.com" || check.Headers["X-Api-Key"] != "key" || check.Labels["team"] != "ops" ||
+		check.Auth.Token != "token" || check.Assertions[0].Contains != "ok" ||
+		check.WebHookTargets[0].URL != "http://example.com/hook" || check.WebHookTargets[0].Headers["X-Source"] != "neverdown" {
+		t.Errorf("the original check was modified: %+v", check)
+	}
+}
@@ -0,0 +1,173 @@
+package neverdown
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// WebHookTarget is a webhook with a custom request, Template is a text/template
+// rendered with a WebHookData (the JSON-encoded check is sent if empty).
+type WebHookTarget struct {
+	URL         string            `json:"url"`
+	Method      string            `json:"method,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Template    string            `json:"template,omitempty"`
+	// Timeout of the request in seconds (defaults to 10 seconds)
+	Timeout int `json:"timeout,omitempty"`
+	// Retry overrides the DefaultRetryPolicy
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	tpl *template.Template
+}
+
+// WebHookData is the data available in the webhook templates.
+type WebHookData struct {
+	Check    *Check
+	Event    string
+	From     string
+	To       string
+	Incident *Incident
+}
+
+var webhookTplFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		js, err := json.Marshal(v)
+		return string(js), err
+	},
+}
+
+// parse returns the parsed template, it's only parsed once (by Validate or compile).
+func (t *WebHookTarget) parse() (*template.Template, error) {
+	if t.tpl != nil {
+		return t.tpl, nil
+	}
+	return template.New("webhook").Funcs(webhookTplFuncs).Option("missingkey=error").Parse(t.Template)
+}
+
+// compile parses and keeps the template of a decoded target, an invalid
+// template is reported by Render.
+func (t *WebHookTarget) compile() {
+	if t.Template == "" {
+		return
+	}
+	if tpl, err := t.parse(); err == nil {
+		t.tpl = tpl
+	}
+}
+
+// Validate checks the target configuration, and renders the template with
+// a sample check, with and without an incident (there is no incident when the
+// check is back up), so template errors are reported when the check is created.
+func (t *WebHookTarget) Validate() error {
+	if !strings.HasPrefix(t.URL, "http://") && !strings.HasPrefix(t.URL, "https://") {
+		return fmt.Errorf("invalid webhook url %q", t.URL)
+	}
+	switch strings.ToUpper(t.Method) {
+	case "", "POST", "PUT", "PATCH", "GET", "DELETE":
+	default:
+		return fmt.Errorf("unsupported webhook method %q", t.Method)
+	}
+	if t.Timeout < 0 || t.Timeout > 60 {
+		return fmt.Errorf("webhook timeout must be between 0 and 60 seconds")
+	}
+	if t.Retry != nil {
+		if err := t.Retry.Validate(); err != nil {
+			return err
+		}
+	}
+	for name := range t.Headers {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\r\n") {
+			return fmt.Errorf("invalid webhook header %q", name)
+		}
+	}
+	if t.Template != "" {
+		tpl, err := t.parse()
+		if err != nil {
+			return fmt.Errorf("invalid webhook template: %v", err)
+		}
+		t.tpl = tpl
+	}
+	sample := NewCheck()
+	sample.ID = "sample"
+	sample.URL = "http://example.com"
+	sample.Event = EventStatus
+	sample.PrevStatus = StatusUp
+	sample.Status = StatusDown
+	sample.LastError = PingError{Type: "server", Error: "connection refused"}
+	incident := &Incident{
+		ID:        "sample",
+		CheckID:   sample.ID,
+		URL:       sample.URL,
+		Error:     &PingError{Type: "server", Error: "connection refused"},
+		Responses: []*PingResponse{},
+	}
+	if _, err := t.Render(sample, incident); err != nil {
+		return fmt.Errorf("invalid webhook template: %v", err)
+	}
+	sample.PrevStatus = StatusDown
+	sample.Status = StatusUp
+	sample.LastError = nil
+	if _, err := t.Render(sample, nil); err != nil {
+		return fmt.Errorf("invalid webhook template (no incident): %v", err)
+	}
+	return nil
+}
+
+// Render returns the request payload for the check event, incident is nil if
+// there is no open incident.
+func (t *WebHookTarget) Render(check *Check, incident *Incident) ([]byte, error) {
+	if t.Template == "" {
+		return json.Marshal(check)
+	}
+	tpl, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &WebHookData{
+		Check:    check.Redacted(),
+		Event:    check.Event,
+		From:     check.PrevStatus,
+		To:       check.Status,
+		Incident: incident,
+	}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ToWebHook returns the WebHook delivering the payload to the target.
+func (t *WebHookTarget) ToWebHook(payload []byte, secret string) *WebHook {
+	headers := map[string]string{}
+	for name, value := range t.Headers {
+		headers[http.CanonicalHeaderKey(name)] = value
+	}
+	if t.ContentType != "" {
+		headers["Content-Type"] = t.ContentType
+	}
+	return &WebHook{
+		Kind:    "webhook",
+		URL:     t.URL,
+		Method:  strings.ToUpper(t.Method),
+		Headers: headers,
+		Timeout: t.Timeout,
+		Retry:   t.Retry,
+		Payload: payload,
+		Secret:  secret,
+	}
+}
+
+// Targets returns every webhook targets of the check, the plain webhooks
+// URLs use the default request (JSON-encoded check POSTed to the URL).
+func (c *Check) Targets() []*WebHookTarget {
+	targets := []*WebHookTarget{}
+	for _, url := range c.WebHooks {
+		targets = append(targets, &WebHookTarget{URL: url})
+	}
+	return append(targets, c.WebHookTargets...)
+}
@@ -0,0 +1,68 @@
+package neverdown
+
+import (
+	"testing"
+)
+
+func TestWebHookTargetValidateTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		template string
+		valid    bool
+	}{
+		{`{"check": {{json .Check.ID}}, "to": {{json .To}}}`, true},
+		{`{{if .Incident}}{{.Incident.Start}}{{end}}`, true},
+		// The incident is nil when the check is back up
+		{`{{.Incident.Start}}`, false},
+		{`{{.Check.Unknown}}`, false},
+		{`{{.Check.ID`, false},
+	} {
+		target := &WebHookTarget{URL: "http://example.com/hook", Template: tc.template}
+		err := target.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("%q should be valid, got %v", tc.template, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%q should be invalid", tc.template)
+		}
+		if tc.valid && target.tpl == nil {
+			t.Errorf("%q template should be kept", tc.template)
+		}
+	}
+}
+
+func TestWebHookTargetRender(t *testing.T) {
+	target := &WebHookTarget{URL: "http://example.com/hook", Template: `{{.Check.ID}} {{.From}}->{{.To}}{{if .Incident}} {{.Incident.ID}}{{end}}`}
+	if err := target.Validate(); err != nil {
+		t.Fatalf("invalid target: %v", err)
+	}
+	check := NewCheck()
+	check.ID = "render"
+	check.PrevStatus = StatusUp
+	check.Status = StatusDown
+	payload, err := target.Render(check, &Incident{ID: "incident"})
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	if expected := "render up->down incident"; string(payload) != expected {
+		t.Errorf("got %q, expected %q", payload, expected)
+	}
+	check.PrevStatus = StatusDown
+	check.Status = StatusUp
+	payload, err = target.Render(check, nil)
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	if expected := "render down->up"; string(payload) != expected {
+		t.Errorf("got %q, expected %q", payload, expected)
+	}
+}
+
+func TestDecodeCheckCompilesTemplates(t *testing.T) {
+	check, err := decodeCheck([]byte(`{"id": "tpl", "webhook_targets": [{"url": "http://example.com/hook", "template": "{{.Check.ID}}"}]}`))
+	if err != nil {
+		t.Fatalf("failed to decode the check: %v", err)
+	}
+	if check.WebHookTargets[0].tpl == nil {
+		t.Errorf("template should be parsed when the check is decoded")
+	}
+}
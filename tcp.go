@@ -0,0 +1,55 @@
+package neverdown
+
+import (
+	"log"
+	"net"
+	nurl "net/url"
+	"strings"
+	"time"
+)
+
+var tcpTimeout = 10 * time.Second
+
+// TCPChecker checks that a TCP connection can be established (tcp://host:port).
+type TCPChecker struct{}
+
+// Check tries to open a TCP connection to the check URL and returns a PingResponse.
+func (tc *TCPChecker) Check(check *Check) (*PingResponse, error) {
+	log.Printf("Checking %v...", check.URL)
+	pr := &PingResponse{
+		URL: check.URL,
+	}
+	u, err := nurl.Parse(check.URL)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", u.Host, tcpTimeout)
+	elapsed := millis(time.Since(start))
+	pr.Timings = &Timings{Connect: elapsed, Total: elapsed}
+	if err != nil {
+		switch cerr := err.(type) {
+		case *net.OpError:
+			switch cerr.Err.(type) {
+			case *net.DNSError:
+				pr.Error.Type = "dns"
+			default:
+				if cerr.Timeout() {
+					pr.Error.Type = "timeout"
+				} else {
+					pr.Error.Type = "server"
+				}
+			}
+			errs := strings.Split(cerr.Error(), ": ")
+			pr.Error.Error = errs[len(errs)-1]
+		default:
+			LogUnknownError("tcp", err, nil)
+			pr.Error.Type = "unknown"
+			pr.Error.Error = err.Error()
+		}
+		return pr, nil
+	}
+	conn.Close()
+	pr.Up = true
+	return pr, nil
+}
@@ -0,0 +1,52 @@
+package neverdown
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTCPCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	check := NewCheck()
+	check.URL = "tcp://" + ln.Addr().String()
+	if err := check.Validate(); err != nil {
+		t.Fatalf("invalid check: %v", err)
+	}
+	pr, err := (&TCPChecker{}).Check(check)
+	if err != nil || !pr.Up {
+		t.Errorf("check should be up, got %v %+v", err, pr)
+	}
+	ln.Close()
+	pr, err = (&TCPChecker{}).Check(check)
+	if err != nil || pr.Up || pr.Error.Type != "server" {
+		t.Errorf("check should be down, got %v %+v", err, pr)
+	}
+}
+
+func TestTCPCheckValidate(t *testing.T) {
+	for _, tc := range []struct {
+		url   string
+		valid bool
+	}{
+		{"tcp://localhost:5432", true},
+		{"tcp://[::1]:5432", true},
+		{"tcp://localhost", false},
+		{"tcp://localhost:", false},
+		{"tcp://localhost:pg", false},
+		{"tcp://localhost:0", false},
+		{"tcp://localhost:65536", false},
+		{"tcp://:5432", false},
+		{"tls://smtp.example.com:465", true},
+		{"tls://smtp.example.com", true},
+		{"tls://smtp.example.com:70000", false},
+	} {
+		check := NewCheck()
+		check.URL = tc.url
+		if err := check.Validate(); tc.valid != (err == nil) {
+			t.Errorf("%v: unexpected error %v", tc.url, err)
+		}
+	}
+}
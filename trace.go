@@ -0,0 +1,128 @@
+package neverdown
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings holds the duration (in milliseconds) of each phase of a check,
+// if redirects are followed, the durations of every requests are summed.
+type Timings struct {
+	DNS     float64 `json:"dns_ms"`
+	Connect float64 `json:"connect_ms"`
+	TLS     float64 `json:"tls_ms"`
+	TTFB    float64 `json:"ttfb_ms"`
+	Total   float64 `json:"total_ms"`
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// checkTrace records the phases of an HTTP check using httptrace.
+type checkTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	timings      Timings
+
+	// errors of the failed phases
+	dnsErr     error
+	connectErr error
+	tlsErr     error
+}
+
+func newCheckTrace() *checkTrace {
+	return &checkTrace{start: time.Now()}
+}
+
+// ClientTrace returns the httptrace hooks.
+func (ct *checkTrace) ClientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.timings.DNS += millis(time.Since(ct.dnsStart))
+			ct.dnsErr = info.Err
+		},
+		ConnectStart: func(network, addr string) {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.connectStart = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.timings.Connect += millis(time.Since(ct.connectStart))
+			ct.connectErr = err
+		},
+		TLSHandshakeStart: func() {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.timings.TLS += millis(time.Since(ct.tlsStart))
+			ct.tlsErr = err
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.timings.TTFB += millis(time.Since(ct.wroteRequest))
+		},
+	}
+}
+
+// Done computes the total duration and returns the timings.
+func (ct *checkTrace) Done() *Timings {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.timings.Total = millis(time.Since(ct.start))
+	timings := ct.timings
+	return &timings
+}
+
+func isTimeout(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// ErrorType returns the error type given the phase that failed.
+func (ct *checkTrace) ErrorType(err error) string {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	switch {
+	case isTimeout(err):
+		return "timeout"
+	case ct.dnsErr != nil:
+		return "dns"
+	case ct.tlsErr != nil || isTLSError(err):
+		return "tls"
+	case ct.connectErr != nil:
+		return "server"
+	case !ct.wroteRequest.IsZero():
+		// The connection was established, the server failed to respond
+		return "server"
+	default:
+		return "unknown"
+	}
+}
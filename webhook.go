@@ -2,49 +2,62 @@ package neverdown
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var WebHookMaxRetry = 20
+// WebHookSecret is the default secret used to sign the webhooks payload.
+var WebHookSecret = ""
+
+// webhookClient has no timeout, the timeout of each WebHook is set on the
+// request context (it can be longer than the default client timeout).
+var webhookClient = &http.Client{}
 
 // ExecuteWebhooks try to execute all webhooks for a given check,
 // if a webhook fail, it will be added to the pending webhook and will
 // be managed by the WebHookScheduler.
-func ExecuteWebhooks(ra *Raft, whSched *WebHookScheduler, check *Check) error {
-	log.Println("executing WebHooks for check %v", check.ID)
-	errc := make(chan error, len(check.WebHooks))
-	payload, err := json.Marshal(check)
-	if err != nil {
-		return err
+func ExecuteWebhooks(ra *Raft, whSched *WebHookScheduler, check *Check, incident *Incident) error {
+	log.Printf("executing WebHooks for check %v", check.ID)
+	targets := check.Targets()
+	errc := make(chan error, len(targets))
+	secret := check.WebHookSecret
+	if secret == "" {
+		secret = WebHookSecret
 	}
 	var wg sync.WaitGroup
-	for _, url := range check.WebHooks {
+	for _, target := range targets {
 		wg.Add(1)
-		go func() {
+		go func(target *WebHookTarget) {
 			defer wg.Done()
-			if err := ExecuteWebhook(ra, payload, url); err != nil {
-				log.Printf("Failed to execute webhook %v for check %v: %v", url, check.ID, err)
-				wh := &WebHook{
-					ID:       uuid(),
-					URL:      url,
-					Payload:  payload,
-					Tries:    1,
-					FirstTry: time.Now().UTC().Unix(),
-				}
-				if err := ra.ExecCommand(wh.ToPostCmd()); err != nil {
+			payload, err := target.Render(check, incident)
+			if err != nil {
+				wh := target.ToWebHook(nil, secret)
+				wh.CheckID = check.ID
+				errc <- renderFailed(ra, wh, err)
+				return
+			}
+			wh := target.ToWebHook(payload, secret)
+			wh.CheckID = check.ID
+			if err := DeliverWebHook(ra, wh); err != nil {
+				log.Printf("Failed to execute webhook %v for check %v: %v", wh.URL, check.ID, err)
+				if err := QueueWebHook(ra, whSched, wh); err != nil {
 					errc <- err
 				}
-				ra.Sync()
-				whSched.Reload()
 			}
-		}()
+		}(target)
 	}
 	wg.Wait()
 	close(errc)
@@ -56,26 +69,154 @@ func ExecuteWebhooks(ra *Raft, whSched *WebHookScheduler, check *Check) error {
 	return nil
 }
 
-// ExecuteWebhook executes a single webhook (POST request to the given url,
-// with the given payload).
-func ExecuteWebhook(ra *Raft, payload []byte, url string) error {
-	log.Printf("Execute WebHook %v: %v", string(payload), url)
-	var body bytes.Buffer
-	body.Write(payload)
-	req, err := http.NewRequest("POST", url, &body)
-	if err != nil {
+// renderFailed records the failed delivery of a webhook whose template couldn't
+// be rendered, and moves it to the dead-letter queue (retrying it would fail the same way).
+func renderFailed(ra *Raft, wh *WebHook, err error) error {
+	log.Printf("Failed to render webhook %v for check %v: %v", wh.URL, wh.CheckID, err)
+	wh.ID = uuid()
+	now := time.Now().UTC()
+	wh.Tries = 1
+	wh.FirstTry = now.Unix()
+	d := &Delivery{
+		WebHookID: wh.ID,
+		CheckID:   wh.CheckID,
+		Kind:      wh.Kind,
+		URL:       wh.URL,
+		Attempt:   1,
+		Time:      now.Unix(),
+		Error:     fmt.Sprintf("failed to render the template: %v", err),
+	}
+	wh.Deliveries = append(wh.Deliveries, d)
+	if cerr := ra.ExecCommand(d.ToCmd()); cerr != nil {
+		log.Printf("Failed to record delivery of webhook %v: %v", wh.ID, cerr)
+	}
+	if derr := DeadLetter(ra, wh); derr != nil {
+		return derr
+	}
+	return errors.New(d.Error)
+}
+
+// QueueWebHook adds a failed notification to the pending webhooks,
+// it will be retried (and signed with its secret, if any) by the WebHookScheduler.
+func QueueWebHook(ra *Raft, whSched *WebHookScheduler, wh *WebHook) error {
+	if wh.ID == "" {
+		wh.ID = uuid()
+	}
+	now := time.Now().UTC()
+	wh.Tries = 1
+	wh.FirstTry = now.Unix()
+	if wh.Policy().Exhausted(wh, now) {
+		return DeadLetter(ra, wh)
+	}
+	wh.ComputeNext(now)
+	if err := ra.ExecCommand(wh.ToPostCmd()); err != nil {
 		return err
 	}
-	resp, err := client.Do(req)
+	return whSched.Reload()
+}
+
+// DeliverWebHook executes a WebHook given its kind, the attempt is recorded
+// in the WebHook deliveries and in the delivery log.
+func DeliverWebHook(ra *Raft, wh *WebHook) error {
+	d, err := attemptWebHook(wh)
+	if cerr := ra.ExecCommand(d.ToCmd()); cerr != nil {
+		log.Printf("Failed to record delivery of webhook %v: %v", wh.ID, cerr)
+	}
+	return err
+}
+
+// attemptWebHook executes the WebHook and records the attempt in the WebHook
+// deliveries, returns the Delivery and the delivery error.
+func attemptWebHook(wh *WebHook) (*Delivery, error) {
+	if wh.ID == "" {
+		wh.ID = uuid()
+	}
+	kind := wh.Kind
+	if kind == "" {
+		kind = "webhook"
+	}
+	start := time.Now().UTC()
+	d := &Delivery{
+		WebHookID: wh.ID,
+		CheckID:   wh.CheckID,
+		Kind:      kind,
+		URL:       wh.URL,
+		Attempt:   wh.Tries + 1,
+		Time:      start.Unix(),
+	}
+	var err error
+	switch kind {
+	case "email":
+		err = SendQueuedEmail(wh.Payload)
+	default:
+		d.StatusCode, d.Response, err = SendWebHook(wh)
+	}
+	d.Latency = millis(time.Since(start))
+	d.Success = err == nil
 	if err != nil {
-		return err
+		d.Error = err.Error()
+	}
+	wh.Deliveries = append(wh.Deliveries, d)
+	if max := *wh.Policy().MaxAttempts; len(wh.Deliveries) > max {
+		wh.Deliveries = wh.Deliveries[len(wh.Deliveries)-max:]
+	}
+	return d, err
+}
+
+// SignWebHook returns the hex-encoded HMAC-SHA256 of the timestamp and the
+// payload ("{timestamp}.{payload}").
+func SignWebHook(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SendWebHook executes the WebHook request (POST and JSON content type by default),
+// returns the status code and the beginning of the response body, any non-2xx
+// response is an error.
+func SendWebHook(wh *WebHook) (int, string, error) {
+	log.Printf("Execute WebHook %v: %v", string(wh.Payload), wh.URL)
+	atomic.AddUint64(&webhookAttempts, 1)
+	method := wh.Method
+	if method == "" {
+		method = "POST"
+	}
+	timeout := time.Duration(wh.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = client.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequest(method, wh.URL, bytes.NewReader(wh.Payload))
+	if err != nil {
+		atomic.AddUint64(&webhookFailures, 1)
+		return 0, "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range wh.Headers {
+		req.Header.Set(name, value)
+	}
+	if wh.Secret != "" {
+		timestamp := time.Now().UTC().Unix()
+		req.Header.Set("X-Neverdown-Timestamp", strconv.FormatInt(timestamp, 10))
+		req.Header.Set("X-Neverdown-Signature", "sha256="+SignWebHook(wh.Secret, timestamp, wh.Payload))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		atomic.AddUint64(&webhookFailures, 1)
+		return 0, "", err
 	}
 	defer resp.Body.Close()
-	data, _ := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		fmt.Errorf("request failed with status code %v %+v: %v", resp.StatusCode, resp, string(data))
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, int64(MaxDeliveryResponse)))
+	// Drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		atomic.AddUint64(&webhookFailures, 1)
+		return resp.StatusCode, string(data), fmt.Errorf("request failed with status code %v", resp.StatusCode)
 	}
-	return nil
+	return resp.StatusCode, string(data), nil
 }
 
 // WebHookScheduler manages the retries of pending WebHooks.
@@ -83,6 +224,7 @@ type WebHookScheduler struct {
 	raft            *Raft
 	stop            chan struct{}
 	Reloadch        chan struct{}
+	retrych         chan string
 	running         bool
 	pendingWebHooks []*WebHook
 }
@@ -92,7 +234,8 @@ func NewWebHookScheduler(raft *Raft) *WebHookScheduler {
 	return &WebHookScheduler{
 		raft:     raft,
 		stop:     make(chan struct{}),
-		Reloadch: make(chan struct{}),
+		Reloadch: make(chan struct{}, 1),
+		retrych:  make(chan string, 64),
 	}
 }
 
@@ -101,18 +244,41 @@ func (d *WebHookScheduler) Stop() {
 	d.stop <- struct{}{}
 }
 
-// Reload will recompute the next execution time of every checks.
-func (d *WebHookScheduler) Reload() {
+// Reload will reload the pending WebHooks from the FSM, it doesn't block: the
+// reloads are coalesced while the scheduler is busy (or not running).
+func (d *WebHookScheduler) Reload() error {
 	if err := d.raft.Sync(); err != nil {
-		panic(err)
+		return err
+	}
+	select {
+	case d.Reloadch <- struct{}{}:
+	default:
+		// A reload is already pending
+	}
+	return nil
+}
+
+// RetryNow forces the immediate redelivery of the given pending WebHook, it
+// doesn't block if the scheduler isn't running (the WebHook is still retried
+// at its scheduled time).
+func (d *WebHookScheduler) RetryNow(id string) error {
+	if err := d.raft.Sync(); err != nil {
+		return err
+	}
+	select {
+	case d.retrych <- id:
+		return nil
+	default:
+		return fmt.Errorf("webhook scheduler busy, %v will be retried at its scheduled time", id)
 	}
-	d.Reloadch <- struct{}{}
 }
 
 // update the pendingWebHooks slicde from the FSM PendingWebHooksIndex.
 func (d *WebHookScheduler) update() error {
+	now := time.Now().UTC()
 	d.pendingWebHooks = []*WebHook{}
-	for _, wh := range d.raft.Store.PendingWebHooksIndex {
+	for _, wh := range d.raft.Store.PendingWebHooks() {
+		wh.restoreNext(now)
 		d.pendingWebHooks = append(d.pendingWebHooks, wh)
 	}
 	return nil
@@ -136,29 +302,38 @@ func (d *WebHookScheduler) Run() {
 		}
 		select {
 		case now = <-time.After(checkTime.Sub(now)):
-			for _, wh := range d.pendingWebHooks {
+			pending := []*WebHook{}
+			for i, wh := range d.pendingWebHooks {
 				if now.Sub(wh.Next) < 0 {
+					pending = append(pending, d.pendingWebHooks[i:]...)
 					break
 				}
 				log.Printf("Retrying webhook %v/%v (tries:%v)", wh.ID, wh.URL, wh.Tries)
-				err := ExecuteWebhook(d.raft, wh.Payload, wh.URL)
-				if err != nil {
-					wh.Tries++
-					if err := d.raft.ExecCommand(wh.ToPostCmd()); err != nil {
+				atomic.AddUint64(&webhookRetries, 1)
+				if err := DeliverWebHook(d.raft, wh); err == nil {
+					log.Printf("WebHook %v delivered after %v tries", wh.ID, wh.Tries+1)
+					if err := d.raft.ExecCommand(wh.ToDeleteCmd()); err != nil {
 						panic(err)
 					}
-					wh.ComputeNext(now)
+					continue
 				}
-				if wh.Tries == WebHookMaxRetry {
-					log.Printf("WARNING: the WebHook %+v will be deleted, after %v failed retries", wh, WebHookMaxRetry)
-					// WebHook sucessfully updated
-					if err := d.raft.ExecCommand(wh.ToDeleteCmd()); err != nil {
+				wh.Tries++
+				if wh.Policy().Exhausted(wh, now) {
+					log.Printf("WARNING: the WebHook %v will be moved to the dead-letter queue, after %v failed tries", wh.ID, wh.Tries)
+					if err := DeadLetter(d.raft, wh); err != nil {
 						panic(err)
 					}
-					d.Reload()
+					continue
 				}
-				continue
+				wh.ComputeNext(now)
+				// Persist the new tries count, the next retry time and the delivery log
+				if err := d.raft.ExecCommand(wh.ToPostCmd()); err != nil {
+					panic(err)
+				}
+				pending = append(pending, wh)
 			}
+			// Delivered and dead webhooks are removed
+			d.pendingWebHooks = pending
 		case <-d.stop:
 			d.running = false
 			return
@@ -166,6 +341,17 @@ func (d *WebHookScheduler) Run() {
 			if err := d.update(); err != nil {
 				panic(err)
 			}
+			now = time.Now().UTC()
+		case id := <-d.retrych:
+			if err := d.update(); err != nil {
+				panic(err)
+			}
+			now = time.Now().UTC()
+			for _, wh := range d.pendingWebHooks {
+				if wh.ID == id {
+					wh.Next = now
+				}
+			}
 		}
 	}
 }
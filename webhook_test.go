@@ -0,0 +1,137 @@
+package neverdown
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignWebHook(t *testing.T) {
+	sig := SignWebHook("secret", 1700000000, []byte(`{"ok":true}`))
+	if expected := "c1afc7c2df3db0690d7d75954610ed1a1d959ce96355ccb8c0a8bc09fd0cfc27"; sig != expected {
+		t.Errorf("bad signature %v, expected %v", sig, expected)
+	}
+}
+
+func TestWebHookPayloadWithoutSecret(t *testing.T) {
+	check := NewCheck()
+	check.ID = "secret"
+	check.URL = "http://example.com"
+	check.WebHookSecret = "s3cr3t"
+	for _, target := range []*WebHookTarget{
+		&WebHookTarget{URL: "http://example.com/hook"},
+		&WebHookTarget{URL: "http://example.com/hook", Template: `{{json .Check}}`},
+		&WebHookTarget{URL: "http://example.com/hook", Template: `{"secret": "{{.Check.WebHookSecret}}"}`},
+	} {
+		payload, err := target.Render(check, nil)
+		if err != nil {
+			t.Fatalf("failed to render %q: %v", target.Template, err)
+		}
+		if bytes.Contains(payload, []byte("s3cr3t")) {
+			t.Errorf("secret leaked in the payload %s", payload)
+		}
+
+		wh := target.ToWebHook(payload, check.WebHookSecret)
+		js, err := json.Marshal(wh)
+		if err != nil {
+			t.Fatalf("failed to marshal the webhook: %v", err)
+		}
+		if bytes.Contains(js, []byte("s3cr3t")) {
+			t.Errorf("secret leaked in the webhook %s", js)
+		}
+		for _, cmd := range [][]byte{wh.ToPostCmd(), wh.ToDeadCmd()} {
+			restored := &WebHook{}
+			if err := json.Unmarshal(cmd[1:], restored); err != nil {
+				t.Fatalf("failed to unmarshal the command: %v", err)
+			}
+			if restored.Secret != "s3cr3t" {
+				t.Errorf("secret missing from the FSM command %s", cmd)
+			}
+		}
+	}
+}
+
+func TestSendWebHookTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the webhook takes 11 seconds to respond")
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, _ := time.ParseDuration(r.URL.Query().Get("delay"))
+		time.Sleep(delay)
+	}))
+	defer ts.Close()
+	// The target timeout is longer than the default client timeout (10 seconds)
+	status, _, err := SendWebHook(&WebHook{URL: ts.URL + "?delay=11s", Timeout: 15})
+	if err != nil || status != http.StatusOK {
+		t.Errorf("the webhook should outlive the default timeout, got %v (status %v)", err, status)
+	}
+	if _, _, err := SendWebHook(&WebHook{URL: ts.URL + "?delay=2s", Timeout: 1}); err == nil {
+		t.Errorf("the webhook should time out after 1 second")
+	}
+}
+
+func TestAttemptWebHook(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.Header.Get("X-Source") != "neverdown" || r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(strings.Repeat("x", 2*MaxDeliveryResponse)))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	target := &WebHookTarget{
+		Method:      "put",
+		Headers:     map[string]string{"x-source": "neverdown"},
+		ContentType: "text/plain",
+	}
+
+	target.URL = ts.URL + "/ok"
+	wh := target.ToWebHook([]byte("payload"), "")
+	d, err := attemptWebHook(wh)
+	if err != nil {
+		t.Fatalf("delivery failed: %v", err)
+	}
+	if !d.Success || d.StatusCode != http.StatusOK || d.Response != "ok" || d.Attempt != 1 || d.Kind != "webhook" {
+		t.Errorf("unexpected delivery %+v", d)
+	}
+
+	// Any non-2xx response is a failure, the response is truncated
+	target.URL = ts.URL + "/fail"
+	wh = target.ToWebHook([]byte("payload"), "")
+	wh.Tries = 2
+	d, err = attemptWebHook(wh)
+	if err == nil {
+		t.Fatalf("the delivery should fail")
+	}
+	if d.Success || d.StatusCode != http.StatusServiceUnavailable || len(d.Response) != MaxDeliveryResponse || d.Attempt != 3 || d.Error == "" {
+		t.Errorf("unexpected delivery %+v", d)
+	}
+	if len(wh.Deliveries) != 1 || wh.Deliveries[0] != d {
+		t.Errorf("the delivery should be recorded in the webhook, got %v", wh.Deliveries)
+	}
+
+	// Only the last MaxAttempts deliveries are kept
+	wh.Retry = &RetryPolicy{MaxAttempts: intPtr(2)}
+	for i := 0; i < 3; i++ {
+		attemptWebHook(wh)
+	}
+	if len(wh.Deliveries) != 2 {
+		t.Errorf("expected 2 deliveries, got %d", len(wh.Deliveries))
+	}
+
+	// Connection errors are failures without a status code
+	ts.Close()
+	d, err = attemptWebHook(target.ToWebHook([]byte("payload"), ""))
+	if err == nil || d.Success || d.StatusCode != 0 || d.Error == "" {
+		t.Errorf("unexpected delivery %+v (%v)", d, err)
+	}
+}